@@ -0,0 +1,163 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBulkheadFull is an error that's returned when a request can't wait for a slot because the queue is full
+var ErrBulkheadFull = errors.New("httpclient: bulkhead queue full")
+
+// ErrBulkheadTimeout is an error that's returned when a request waited longer than the queue timeout for a slot
+var ErrBulkheadTimeout = errors.New("httpclient: bulkhead queue timeout")
+
+// BulkheadConfig is the configuration for NewBulkhead
+type BulkheadConfig struct {
+	// MaxInFlight is the maximum number of requests in flight, unlimited when zero
+	MaxInFlight int
+	// MaxInFlightPerHost is the maximum number of requests in flight for each host (or key), unlimited when zero
+	MaxInFlightPerHost int
+	// MaxQueue is the maximum number of requests waiting for a slot. When zero a request fails
+	// with ErrBulkheadFull as soon as there is no free slot.
+	MaxQueue int
+	// QueueTimeout is the maximum time a request waits for a slot, until the context is done when zero
+	QueueTimeout time.Duration
+	// Key returns the key of the per host limit for the request, defaults to the host of the request URL
+	Key func(req *http.Request) string
+}
+
+type bulkhead struct {
+	config  BulkheadConfig
+	global  chan struct{}
+	mu      sync.Mutex
+	hosts   map[string]chan struct{}
+	waiting int
+}
+
+// make sure it implements the interface
+var _ Bulkhead = (*bulkhead)(nil)
+
+// NewBulkhead returns a Bulkhead which limits the number of requests in flight globally and per host
+func NewBulkhead(config BulkheadConfig) Bulkhead {
+	if config.Key == nil {
+		config.Key = HostKey
+	}
+	b := &bulkhead{
+		config: config,
+		hosts:  make(map[string]chan struct{}),
+	}
+	if config.MaxInFlight > 0 {
+		b.global = make(chan struct{}, config.MaxInFlight)
+	}
+	return b
+}
+
+// host returns the slots for the key or nil if unlimited
+func (b *bulkhead) host(key string) chan struct{} {
+	if b.config.MaxInFlightPerHost <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	slots := b.hosts[key]
+	if slots == nil {
+		slots = make(chan struct{}, b.config.MaxInFlightPerHost)
+		b.hosts[key] = slots
+	}
+	return slots
+}
+
+// tryAcquire takes a slot without waiting, returning false if there is none free
+func tryAcquire(slots chan struct{}) bool {
+	if slots == nil {
+		return true
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquire waits for a slot until the context is done or the timeout fires
+func acquire(ctx context.Context, slots chan struct{}, timeout <-chan time.Time) error {
+	if slots == nil {
+		return nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return ErrBulkheadTimeout
+	}
+}
+
+func release(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+func (b *bulkhead) Acquire(ctx context.Context, req *http.Request) (func(), error) {
+	host := b.host(b.config.Key(req))
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			release(host)
+			release(b.global)
+		})
+	}
+	if tryAcquire(b.global) {
+		if tryAcquire(host) {
+			return done, nil
+		}
+		release(b.global)
+	}
+	b.mu.Lock()
+	if b.waiting >= b.config.MaxQueue {
+		b.mu.Unlock()
+		return nil, ErrBulkheadFull
+	}
+	b.waiting++
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.waiting--
+		b.mu.Unlock()
+	}()
+	var timeout <-chan time.Time
+	if b.config.QueueTimeout > 0 {
+		timer := time.NewTimer(b.config.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	// wait for the host first so that requests queued for a busy host don't hold the global
+	// slots which requests for other hosts could use
+	if err := acquire(ctx, host, timeout); err != nil {
+		return nil, err
+	}
+	if err := acquire(ctx, b.global, timeout); err != nil {
+		release(host)
+		return nil, err
+	}
+	return done, nil
+}
+
+// releaseBody releases the bulkhead slot of a request when its response body is closed
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
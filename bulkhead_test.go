@@ -0,0 +1,181 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitQueued waits until there are n requests waiting for a slot
+func waitQueued(b Bulkhead, n int) {
+	bh := b.(*bulkhead)
+	for {
+		bh.mu.Lock()
+		waiting := bh.waiting
+		bh.mu.Unlock()
+		if waiting >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBulkhead(t *testing.T) {
+	assert := assert.New(t)
+	b := NewBulkhead(BulkheadConfig{MaxInFlight: 3, MaxInFlightPerHost: 2, MaxQueue: 1, QueueTimeout: 10 * time.Millisecond})
+	foo, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	other, _ := http.NewRequest(http.MethodGet, "https://other.com/bar", nil)
+	ctx := context.Background()
+	release1, err := b.Acquire(ctx, foo)
+	assert.NoError(err)
+	_, err = b.Acquire(ctx, foo)
+	assert.NoError(err)
+	// the host is full so this waits in the queue until the timeout
+	_, err = b.Acquire(ctx, foo)
+	assert.Equal(ErrBulkheadTimeout, err)
+	release3, err := b.Acquire(ctx, other)
+	assert.NoError(err)
+	// all slots are taken
+	waited := make(chan error)
+	go func() {
+		release, err := b.Acquire(ctx, other)
+		if release != nil {
+			release()
+		}
+		waited <- err
+	}()
+	waitQueued(b, 1)
+	// the queue is full
+	_, err = b.Acquire(ctx, other)
+	assert.Equal(ErrBulkheadFull, err)
+	release3()
+	assert.NoError(<-waited)
+	release1()
+	release1()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	release, err := b.Acquire(cancelled, foo)
+	assert.NoError(err)
+	release()
+	_, err = b.Acquire(cancelled, other)
+	assert.NoError(err)
+	_, err = b.Acquire(cancelled, other)
+	assert.NoError(err)
+	// a request which has to wait gives up when the context is done
+	_, err = b.Acquire(cancelled, other)
+	assert.Equal(context.Canceled, err)
+}
+
+func TestBulkheadQueuedHost(t *testing.T) {
+	assert := assert.New(t)
+	b := NewBulkhead(BulkheadConfig{MaxInFlight: 2, MaxInFlightPerHost: 1, MaxQueue: 5, QueueTimeout: time.Second})
+	a, _ := http.NewRequest(http.MethodGet, "https://a.com/bar", nil)
+	other, _ := http.NewRequest(http.MethodGet, "https://b.com/bar", nil)
+	releaseA, err := b.Acquire(context.Background(), a)
+	assert.NoError(err)
+	waited := make(chan error)
+	go func() {
+		release, err := b.Acquire(context.Background(), a)
+		if release != nil {
+			release()
+		}
+		waited <- err
+	}()
+	waitQueued(b, 1)
+	// the request queued for a.com doesn't hold a global slot so b.com isn't starved
+	started := time.Now()
+	releaseB, err := b.Acquire(context.Background(), other)
+	assert.NoError(err)
+	assert.True(time.Since(started) < 100*time.Millisecond)
+	releaseA()
+	assert.NoError(<-waited)
+	releaseB()
+}
+
+func TestDoBulkhead(t *testing.T) {
+	assert := assert.New(t)
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("ok"))}, nil
+	})
+	config := NewConfig()
+	config.Bulkhead = NewBulkhead(BulkheadConfig{MaxInFlightPerHost: 1})
+	client := NewHTTPClient(nil, config, tc)
+	resp, err := client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	// the slot is held until the body is closed
+	_, err = client.Get("https://foo.com/bar")
+	assert.True(errors.Is(err, ErrBulkheadFull))
+	resp.Body.Close()
+	resp, err = client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	buf, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal("ok", string(buf))
+	resp.Body.Close()
+}
+
+func TestDoBulkheadCircuitOpen(t *testing.T) {
+	assert := assert.New(t)
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusBadGateway, Body: ioutil.NopCloser(strings.NewReader("bad"))}, nil
+	})
+	b, clock := newTestCircuitBreaker(CircuitBreakerConfig{ConsecutiveFailures: 1})
+	config := NewConfig()
+	config.CircuitBreaker = b
+	config.Bulkhead = NewBulkhead(BulkheadConfig{MaxInFlightPerHost: 1})
+	client := NewHTTPClient(nil, config, tc)
+	resp, err := client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(CircuitOpen, b.State("foo.com"))
+	// an open circuit is reported before the bulkhead is even asked for a slot
+	_, err = client.Get("https://foo.com/bar")
+	assert.True(errors.Is(err, ErrCircuitOpen))
+	// a probe which doesn't get a slot doesn't count against the circuit
+	clock.now = clock.now.Add(DefaultCircuitOpenDuration)
+	for i := 0; i < 2; i++ {
+		_, err = client.Get("https://foo.com/bar")
+		assert.True(errors.Is(err, ErrBulkheadFull))
+		assert.Equal(CircuitHalfOpen, b.State("foo.com"))
+	}
+	resp.Body.Close()
+}
+
+func TestDoBulkheadPaginator(t *testing.T) {
+	assert := assert.New(t)
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"items":[1],"paging":{"pageIndex":1,"pageSize":1,"total":1}}`
+		if req.URL.Path == "/nopaging" {
+			body = `{"items":[1]}`
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+	})
+	config := NewConfig()
+	config.Paginator = InBodyPaginator()
+	config.Bulkhead = NewBulkhead(BulkheadConfig{MaxInFlight: 2})
+	client := NewHTTPClient(nil, config, tc)
+	// the paginator reads the body so the slot must be released when it replaces it
+	for i := 0; i < 3; i++ {
+		for _, path := range []string{"/bar", "/nopaging"} {
+			resp, err := client.Get("https://foo.com" + path + "?p=1")
+			assert.NoError(err)
+			resp.Body.Close()
+		}
+	}
+	// and when the pages are prefetched
+	tc = ClientFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"items":[1],"paging":{"pageIndex":` + req.URL.Query().Get("p") + `,"pageSize":1,"total":3}}`
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body))}, nil
+	})
+	config.PrefetchConcurrency = 2
+	client = NewHTTPClient(nil, config, tc)
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get("https://foo.com/bar?p=1")
+		assert.NoError(err)
+		resp.Body.Close()
+	}
+}
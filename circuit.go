@@ -0,0 +1,242 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is an error that's returned when a request isn't sent because the circuit is open
+var ErrCircuitOpen = errors.New("httpclient: circuit open")
+
+// CircuitOpenError is returned by Do when the circuit for a request is open. It matches
+// ErrCircuitOpen with errors.Is.
+type CircuitOpenError struct {
+	Key   string
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v for %s", ErrCircuitOpen, e.Key)
+}
+
+// Is returns true if the target is ErrCircuitOpen
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitState is the state of a circuit
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all requests until the open duration has passed
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of requests through to probe if the upstream recovered
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitResult is the outcome of an attempt told to a CircuitBreaker
+type CircuitResult int
+
+const (
+	// CircuitSuccess is an attempt which the upstream handled
+	CircuitSuccess CircuitResult = iota
+	// CircuitFailure is an attempt which failed because of the upstream
+	CircuitFailure
+	// CircuitIgnore is an attempt which says nothing about the upstream, such as one cancelled by
+	// the caller or one which failed with a permanent error
+	CircuitIgnore
+)
+
+// CircuitBreakerConfig is the configuration for NewCircuitBreaker
+type CircuitBreakerConfig struct {
+	// Key returns the key of the circuit for the request, defaults to the host of the request URL
+	Key func(req *http.Request) string
+	// ConsecutiveFailures trips the circuit after this many failures in a row, defaults to 5 when
+	// neither ConsecutiveFailures nor FailureRatio are set
+	ConsecutiveFailures int
+	// FailureRatio trips the circuit when the ratio of failed requests reaches it, once there
+	// have been at least MinRequests requests in the Interval
+	FailureRatio float64
+	// MinRequests is the minimum number of requests before FailureRatio is considered
+	MinRequests int
+	// Interval is how often the counts of a closed circuit are cleared, never when zero
+	Interval time.Duration
+	// OpenDuration is how long the circuit stays open before it's half-open, defaults to 30s
+	OpenDuration time.Duration
+	// HalfOpenRequests is the number of concurrent requests let through when half-open, defaults to 1
+	HalfOpenRequests int
+}
+
+// DefaultCircuitOpenDuration is how long a circuit stays open when CircuitBreakerConfig.OpenDuration isn't set
+const DefaultCircuitOpenDuration = 30 * time.Second
+
+type circuit struct {
+	state     CircuitState
+	requests  int
+	failures  int
+	failedRow int
+	probes    int
+	expires   time.Time
+}
+
+type circuitBreaker struct {
+	config   CircuitBreakerConfig
+	now      func() time.Time
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// make sure it implements the interface
+var _ CircuitBreaker = (*circuitBreaker)(nil)
+
+// NewCircuitBreaker returns a CircuitBreaker which keeps a circuit per host (or per key)
+func NewCircuitBreaker(config CircuitBreakerConfig) CircuitBreaker {
+	if config.Key == nil {
+		config.Key = HostKey
+	}
+	if config.ConsecutiveFailures <= 0 && config.FailureRatio <= 0 {
+		config.ConsecutiveFailures = 5
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = DefaultCircuitOpenDuration
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	return &circuitBreaker{
+		config:   config,
+		now:      time.Now,
+		circuits: make(map[string]*circuit),
+	}
+}
+
+// HostKey returns the host of the request URL for keying a circuit or a limiter by host
+func HostKey(req *http.Request) string {
+	return req.URL.Host
+}
+
+// circuit returns the circuit for the key moving it to the next state if it's time to, must
+// be called with the lock held
+func (b *circuitBreaker) circuit(key string) *circuit {
+	c := b.circuits[key]
+	if c == nil {
+		c = &circuit{}
+		if b.config.Interval > 0 {
+			c.expires = b.now().Add(b.config.Interval)
+		}
+		b.circuits[key] = c
+	}
+	now := b.now()
+	switch c.state {
+	case CircuitClosed:
+		if !c.expires.IsZero() && !now.Before(c.expires) {
+			b.setState(c, CircuitClosed)
+		}
+	case CircuitOpen:
+		if !now.Before(c.expires) {
+			b.setState(c, CircuitHalfOpen)
+		}
+	}
+	return c
+}
+
+// setState moves the circuit to the state and clears the counts, must be called with the lock held
+func (b *circuitBreaker) setState(c *circuit, state CircuitState) {
+	c.state = state
+	c.requests = 0
+	c.failures = 0
+	c.failedRow = 0
+	c.probes = 0
+	c.expires = time.Time{}
+	switch state {
+	case CircuitClosed:
+		if b.config.Interval > 0 {
+			c.expires = b.now().Add(b.config.Interval)
+		}
+	case CircuitOpen:
+		c.expires = b.now().Add(b.config.OpenDuration)
+	}
+}
+
+// State returns the state of the circuit for the key
+func (b *circuitBreaker) State(key string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.circuit(key).state
+}
+
+func (b *circuitBreaker) Allow(req *http.Request) (func(result CircuitResult), error) {
+	key := b.config.Key(req)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(key)
+	switch c.state {
+	case CircuitOpen:
+		return nil, &CircuitOpenError{Key: key, Until: c.expires}
+	case CircuitHalfOpen:
+		if c.probes >= b.config.HalfOpenRequests {
+			return nil, &CircuitOpenError{Key: key}
+		}
+		c.probes++
+	}
+	state := c.state
+	var once sync.Once
+	return func(result CircuitResult) {
+		once.Do(func() { b.done(key, state, result) })
+	}, nil
+}
+
+func (b *circuitBreaker) done(key string, state CircuitState, result CircuitResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(key)
+	if c.state != state {
+		// the circuit changed while the request was in flight so the outcome no longer applies
+		return
+	}
+	switch c.state {
+	case CircuitHalfOpen:
+		switch result {
+		case CircuitFailure:
+			b.setState(c, CircuitOpen)
+		case CircuitSuccess:
+			b.setState(c, CircuitClosed)
+		default:
+			// let another request probe the upstream
+			c.probes--
+		}
+	case CircuitClosed:
+		switch result {
+		case CircuitSuccess:
+			c.requests++
+			c.failedRow = 0
+		case CircuitFailure:
+			c.requests++
+			c.failures++
+			c.failedRow++
+			if b.config.ConsecutiveFailures > 0 && c.failedRow >= b.config.ConsecutiveFailures {
+				b.setState(c, CircuitOpen)
+			} else if b.config.FailureRatio > 0 && c.requests >= b.config.MinRequests &&
+				float64(c.failures)/float64(c.requests) >= b.config.FailureRatio {
+				b.setState(c, CircuitOpen)
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestCircuitBreaker(config CircuitBreakerConfig) (*circuitBreaker, *testClock) {
+	clock := &testClock{now: time.Now()}
+	b := NewCircuitBreaker(config).(*circuitBreaker)
+	b.now = clock.Now
+	return b, clock
+}
+
+func TestCircuitBreakerConsecutiveFailures(t *testing.T) {
+	assert := assert.New(t)
+	b, clock := newTestCircuitBreaker(CircuitBreakerConfig{ConsecutiveFailures: 3, OpenDuration: time.Minute})
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	other, _ := http.NewRequest(http.MethodGet, "https://other.com/bar", nil)
+	for _, result := range []CircuitResult{CircuitFailure, CircuitFailure, CircuitSuccess, CircuitFailure, CircuitIgnore, CircuitFailure} {
+		done, err := b.Allow(req)
+		assert.NoError(err)
+		done(result)
+	}
+	assert.Equal(CircuitClosed, b.State("foo.com"))
+	done, err := b.Allow(req)
+	assert.NoError(err)
+	done(CircuitFailure)
+	assert.Equal(CircuitOpen, b.State("foo.com"))
+	_, err = b.Allow(req)
+	assert.True(errors.Is(err, ErrCircuitOpen))
+	assert.EqualError(err, "httpclient: circuit open for foo.com")
+	// other hosts aren't affected
+	_, err = b.Allow(other)
+	assert.NoError(err)
+	clock.now = clock.now.Add(time.Minute)
+	assert.Equal(CircuitHalfOpen, b.State("foo.com"))
+	probe, err := b.Allow(req)
+	assert.NoError(err)
+	_, err = b.Allow(req)
+	assert.True(errors.Is(err, ErrCircuitOpen))
+	probe(CircuitFailure)
+	assert.Equal(CircuitOpen, b.State("foo.com"))
+	clock.now = clock.now.Add(time.Minute)
+	// a probe which was cancelled lets another request probe
+	probe, err = b.Allow(req)
+	assert.NoError(err)
+	probe(CircuitIgnore)
+	assert.Equal(CircuitHalfOpen, b.State("foo.com"))
+	probe, err = b.Allow(req)
+	assert.NoError(err)
+	probe(CircuitSuccess)
+	probe(CircuitFailure)
+	assert.Equal(CircuitClosed, b.State("foo.com"))
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	assert := assert.New(t)
+	b, clock := newTestCircuitBreaker(CircuitBreakerConfig{FailureRatio: 0.5, MinRequests: 4, Interval: time.Minute})
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	for _, result := range []CircuitResult{CircuitFailure, CircuitSuccess, CircuitIgnore, CircuitFailure} {
+		done, _ := b.Allow(req)
+		done(result)
+	}
+	assert.Equal(CircuitClosed, b.State("foo.com"))
+	// the counts are cleared after the interval
+	clock.now = clock.now.Add(time.Minute)
+	done, _ := b.Allow(req)
+	done(CircuitFailure)
+	assert.Equal(CircuitClosed, b.State("foo.com"))
+	for _, result := range []CircuitResult{CircuitSuccess, CircuitSuccess, CircuitFailure} {
+		done, _ := b.Allow(req)
+		done(result)
+	}
+	assert.Equal(CircuitOpen, b.State("foo.com"))
+}
+
+func TestDoCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+	var count int
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		count++
+		if req.URL.Path == "/refused" {
+			return nil, syscall.ECONNREFUSED
+		}
+		return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+	})
+	config := NewConfig()
+	config.Retryable = NewBackoffRetry(time.Millisecond, time.Millisecond, time.Second, 1)
+	config.CircuitBreaker = NewCircuitBreaker(CircuitBreakerConfig{ConsecutiveFailures: 3})
+	client := NewHTTPClient(nil, config, tc)
+	resp, err := client.Get("https://foo.com/bar")
+	assert.Nil(resp)
+	var openErr *CircuitOpenError
+	assert.True(errors.As(err, &openErr))
+	assert.Equal("foo.com", openErr.Key)
+	assert.Equal(3, count)
+	_, err = client.Get("https://foo.com/bar")
+	assert.True(errors.Is(err, ErrCircuitOpen))
+	assert.Equal(3, count)
+	_, err = client.Get("https://other.com/refused")
+	assert.True(errors.Is(err, ErrCircuitOpen))
+	assert.Equal(6, count)
+}
+
+func TestDoCircuitBreakerCancelledProbe(t *testing.T) {
+	assert := assert.New(t)
+	b, clock := newTestCircuitBreaker(CircuitBreakerConfig{ConsecutiveFailures: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/cancel" {
+			cancel()
+			return nil, req.Context().Err()
+		}
+		return &http.Response{StatusCode: http.StatusBadGateway}, nil
+	})
+	config := NewConfig()
+	config.CircuitBreaker = b
+	client := NewHTTPClient(nil, config, tc)
+	_, err := client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(CircuitOpen, b.State("foo.com"))
+	clock.now = clock.now.Add(DefaultCircuitOpenDuration)
+	// the probe cancelled by the caller says nothing about the upstream
+	_, err = client.GetContext(ctx, "https://foo.com/cancel")
+	assert.True(errors.Is(err, context.Canceled))
+	assert.Equal(CircuitHalfOpen, b.State("foo.com"))
+	_, err = client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(CircuitOpen, b.State("foo.com"))
+}
+
+func TestDoCircuitBreakerStatus(t *testing.T) {
+	assert := assert.New(t)
+	status := http.StatusInternalServerError
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: status}, nil
+	})
+	b, _ := newTestCircuitBreaker(CircuitBreakerConfig{ConsecutiveFailures: 2})
+	config := NewConfig()
+	config.CircuitBreaker = b
+	client := NewHTTPClient(nil, config, tc)
+	// a 304, or a 429 from an upstream which is throttling, isn't a failure
+	for _, status = range []int{http.StatusInternalServerError, http.StatusNotModified, http.StatusInternalServerError, http.StatusTooManyRequests} {
+		resp, err := client.Get("https://foo.com/bar")
+		assert.NoError(err)
+		assert.Equal(status, resp.StatusCode)
+	}
+	assert.Equal(CircuitClosed, b.State("foo.com"))
+	// the default StatusPolicy doesn't retry a 500 but it's still a failure
+	status = http.StatusInternalServerError
+	_, err := client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(CircuitOpen, b.State("foo.com"))
+}
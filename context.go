@@ -0,0 +1,94 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// mergedContext is a context which is done when either of its parents is done. Values are looked
+// up in the primary context first and the deadline is the earliest of the two.
+type mergedContext struct {
+	primary   context.Context
+	secondary context.Context
+	done      chan struct{}
+	once      sync.Once
+	mu        sync.Mutex
+	err       error
+}
+
+var _ context.Context = (*mergedContext)(nil)
+
+func (c *mergedContext) Deadline() (time.Time, bool) {
+	deadline, ok := c.primary.Deadline()
+	if other, otherOK := c.secondary.Deadline(); otherOK && (!ok || other.Before(deadline)) {
+		return other, true
+	}
+	return deadline, ok
+}
+
+func (c *mergedContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *mergedContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *mergedContext) Value(key interface{}) interface{} {
+	if v := c.primary.Value(key); v != nil {
+		return v
+	}
+	return c.secondary.Value(key)
+}
+
+func (c *mergedContext) cancel(err error) {
+	c.once.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.done)
+	})
+}
+
+// mergeContext returns a context which is cancelled when either the primary or the secondary
+// context is done. The returned cancel func, which releases the resources of the merged context,
+// is nil when no merge was needed because one of the contexts can never be done.
+func mergeContext(primary context.Context, secondary context.Context) (context.Context, context.CancelFunc) {
+	if primary == nil || primary == secondary || primary == context.Background() {
+		return secondary, nil
+	}
+	if secondary == nil || secondary == context.Background() {
+		return primary, nil
+	}
+	c := &mergedContext{
+		primary:   primary,
+		secondary: secondary,
+		done:      make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-primary.Done():
+			c.cancel(primary.Err())
+		case <-secondary.Done():
+			c.cancel(secondary.Err())
+		case <-c.done:
+		}
+	}()
+	return c, func() { c.cancel(context.Canceled) }
+}
+
+// cancelBody will cancel the context of the request once the response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,68 @@
+package httpclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testContextKey string
+
+func TestMergeContextNoMerge(t *testing.T) {
+	assert := assert.New(t)
+	client := context.WithValue(context.Background(), testContextKey("a"), "b")
+	ctx, cancel := mergeContext(context.Background(), client)
+	assert.Nil(cancel)
+	assert.Equal(client, ctx)
+	ctx, cancel = mergeContext(client, context.Background())
+	assert.Nil(cancel)
+	assert.Equal(client, ctx)
+}
+
+func TestMergeContextValues(t *testing.T) {
+	assert := assert.New(t)
+	client, clientCancel := context.WithCancel(context.WithValue(context.Background(), testContextKey("a"), "client"))
+	defer clientCancel()
+	req := context.WithValue(context.Background(), testContextKey("a"), "req")
+	req = context.WithValue(req, testContextKey("b"), "req")
+	ctx, cancel := mergeContext(req, client)
+	assert.NotNil(cancel)
+	assert.Equal("req", ctx.Value(testContextKey("a")))
+	assert.Equal("req", ctx.Value(testContextKey("b")))
+	ctx, cancel = mergeContext(context.WithValue(client, testContextKey("c"), "d"), context.WithValue(client, testContextKey("b"), "client"))
+	assert.Equal("client", ctx.Value(testContextKey("b")))
+	assert.Nil(ctx.Err())
+	cancel()
+	<-ctx.Done()
+	assert.Equal(context.Canceled, ctx.Err())
+}
+
+func TestMergeContextDeadline(t *testing.T) {
+	assert := assert.New(t)
+	client, clientCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer clientCancel()
+	req, reqCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer reqCancel()
+	ctx, cancel := mergeContext(req, client)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(ok)
+	reqDeadline, _ := req.Deadline()
+	assert.Equal(reqDeadline, deadline)
+	<-ctx.Done()
+	assert.Equal(context.DeadlineExceeded, ctx.Err())
+}
+
+func TestMergeContextClientCancel(t *testing.T) {
+	assert := assert.New(t)
+	client, clientCancel := context.WithCancel(context.Background())
+	req, reqCancel := context.WithCancel(context.Background())
+	defer reqCancel()
+	ctx, cancel := mergeContext(req, client)
+	defer cancel()
+	clientCancel()
+	<-ctx.Done()
+	assert.Equal(context.Canceled, ctx.Err())
+}
@@ -0,0 +1,120 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// ErrInvalidDecodeTarget is an error that's returned when DecodePages isn't passed a pointer to a slice or a channel
+var ErrInvalidDecodeTarget = errors.New("httpclient: decode target must be a pointer to a slice or a channel")
+
+// ErrItemsPathNotFound is an error that's returned when a page passed to DecodePages doesn't have the items path
+var ErrItemsPathNotFound = errors.New("httpclient: items path not found")
+
+// DecodePages fetches each page of the request and decodes the JSON body of the page, merging the
+// items of all the pages into out which must be either a pointer to a slice or a channel, which
+// isn't closed when done. If itemsPath is set (as a dot separated path such as "data.items") the items
+// of each page are read from that field, otherwise the page itself is used. A page without the field
+// returns an error wrapping ErrItemsPathNotFound while a null field is an empty page. When the items
+// are an array each element is added, otherwise the items are decoded as a single element.
+func (c *HTTPClient) DecodePages(req *http.Request, itemsPath string, out interface{}) error {
+	target := reflect.ValueOf(out)
+	var elemType reflect.Type
+	switch {
+	case target.Kind() == reflect.Ptr && target.Elem().Kind() == reflect.Slice:
+		elemType = target.Elem().Type().Elem()
+	case target.Kind() == reflect.Chan && target.Type().ChanDir()&reflect.SendDir != 0:
+		elemType = target.Type().Elem()
+	default:
+		return ErrInvalidDecodeTarget
+	}
+	pages := c.Pages(req)
+	defer pages.Close()
+	for pages.Next() {
+		resp := pages.Response()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return c.newHTTPError(pages.req, resp)
+		}
+		var page json.RawMessage
+		// only decode the first value since some paginators (such as InBodyPaginator) add trailing data
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			return fmt.Errorf("httpclient: error decoding page %d: %w", pages.Page(), err)
+		}
+		items, ok := lookupJSON(page, itemsPath)
+		if !ok {
+			return fmt.Errorf("%w: %q on page %d", ErrItemsPathNotFound, itemsPath, pages.Page())
+		}
+		if isJSONNull(items) {
+			continue
+		}
+		var elems []json.RawMessage
+		if isJSONArray(items) {
+			if err := json.Unmarshal(items, &elems); err != nil {
+				return fmt.Errorf("httpclient: error decoding page %d: %w", pages.Page(), err)
+			}
+		} else {
+			elems = []json.RawMessage{items}
+		}
+		for _, elem := range elems {
+			v := reflect.New(elemType)
+			if err := json.Unmarshal(elem, v.Interface()); err != nil {
+				return fmt.Errorf("httpclient: error decoding page %d: %w", pages.Page(), err)
+			}
+			if target.Kind() == reflect.Chan {
+				chosen, _, _ := reflect.Select([]reflect.SelectCase{
+					{Dir: reflect.SelectSend, Chan: target, Send: v.Elem()},
+					{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(pages.ctx.Done())},
+				})
+				if chosen == 1 {
+					return pages.contextError(pages.ctx.Err())
+				}
+			} else {
+				target.Elem().Set(reflect.Append(target.Elem(), v.Elem()))
+			}
+		}
+	}
+	return pages.Err()
+}
+
+// jsonPath returns the value at the dot separated path of object keys, or the value itself for an empty path.
+// It returns false if the path doesn't exist or the value is null.
+func jsonPath(value json.RawMessage, path string) (json.RawMessage, bool) {
+	value, ok := lookupJSON(value, path)
+	if !ok || isJSONNull(value) {
+		return nil, false
+	}
+	return value, true
+}
+
+// lookupJSON returns the value at the dot separated path like jsonPath but only returns false
+// if the path doesn't exist, returning a null value as is
+func lookupJSON(value json.RawMessage, path string) (json.RawMessage, bool) {
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			var obj map[string]json.RawMessage
+			if err := json.Unmarshal(value, &obj); err != nil {
+				return nil, false
+			}
+			v, ok := obj[key]
+			if !ok {
+				return nil, false
+			}
+			value = v
+		}
+	}
+	return value, true
+}
+
+func isJSONNull(value json.RawMessage) bool {
+	return len(value) == 0 || bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
+
+func isJSONArray(value json.RawMessage) bool {
+	value = bytes.TrimSpace(value)
+	return len(value) > 0 && value[0] == '['
+}
@@ -0,0 +1,145 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testItem struct {
+	ID int `json:"id"`
+}
+
+// testJSONPagesClient returns a JSON page with a link to the next page
+type testJSONPagesClient struct {
+	testClient
+	pages  []string
+	status int
+}
+
+func (c *testJSONPagesClient) Do(req *http.Request) (*http.Response, error) {
+	page := 1
+	if p := req.URL.Query().Get("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	status := http.StatusOK
+	if page == len(c.pages) && c.status != 0 {
+		status = c.status
+	}
+	resp := &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       &testReader{buf: *bytes.NewBufferString(c.pages[page-1])},
+		Request:    req,
+	}
+	if page < len(c.pages) {
+		resp.Header.Set("Link", fmt.Sprintf(`<https://foo.com/bar?page=%d>; rel="next"`, page+1))
+	}
+	return resp, nil
+}
+
+func newTestJSONPagesClient(pages ...string) (*testJSONPagesClient, *HTTPClient) {
+	tc := &testJSONPagesClient{pages: pages}
+	config := NewConfig()
+	config.Paginator = NewLinkPaginator()
+	return tc, NewHTTPClient(context.Background(), config, tc)
+}
+
+func TestDecodePagesArray(t *testing.T) {
+	assert := assert.New(t)
+	_, client := newTestJSONPagesClient(`[{"id":1},{"id":2}]`, `[{"id":3}]`, `[]`)
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	var items []testItem
+	assert.NoError(client.DecodePages(req, "", &items))
+	assert.Equal([]testItem{{1}, {2}, {3}}, items)
+}
+
+func TestDecodePagesPath(t *testing.T) {
+	assert := assert.New(t)
+	_, client := newTestJSONPagesClient(`{"data":{"items":[{"id":1}]}}`, `{"data":{"items":null}}`, `{"data":{"items":[{"id":2}]}},`)
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	var items []*testItem
+	assert.NoError(client.DecodePages(req, "data.items", &items))
+	assert.Len(items, 2)
+	assert.Equal(1, items[0].ID)
+	assert.Equal(2, items[1].ID)
+}
+
+func TestDecodePagesChannel(t *testing.T) {
+	assert := assert.New(t)
+	_, client := newTestJSONPagesClient(`{"id":1}`, `[{"id":2},{"id":3}]`)
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	ch := make(chan testItem, 10)
+	assert.NoError(client.DecodePages(req, "", ch))
+	close(ch)
+	var items []testItem
+	for item := range ch {
+		items = append(items, item)
+	}
+	assert.Equal([]testItem{{1}, {2}, {3}}, items)
+}
+
+func TestDecodePagesChannelCancelled(t *testing.T) {
+	assert := assert.New(t)
+	_, client := newTestJSONPagesClient(`[{"id":1},{"id":2}]`)
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	req = req.WithContext(ctx)
+	ch := make(chan testItem)
+	go func() {
+		<-ch
+		cancel()
+	}()
+	err := client.DecodePages(req, "", ch)
+	assert.True(errors.Is(err, context.Canceled))
+	assert.EqualError(err, "httpclient: GET https://foo.com/bar cancelled on page 1: context canceled")
+}
+
+func TestDecodePagesErrors(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestJSONPagesClient(`[{"id":1}]`, `{"error":"bad"}`)
+	tc.status = http.StatusBadRequest
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	var items []testItem
+	assert.Equal(ErrInvalidDecodeTarget, client.DecodePages(req, "", items))
+	err := client.DecodePages(req, "", &items)
+	httpErr, ok := err.(*HTTPError)
+	assert.True(ok)
+	assert.Equal(http.StatusBadRequest, httpErr.StatusCode)
+	assert.Equal(`{"error":"bad"}`, string(httpErr.Body))
+	_, client = newTestJSONPagesClient(`[{"id":"1"}]`)
+	var syntaxErr *json.UnmarshalTypeError
+	assert.ErrorAs(client.DecodePages(req, "", &items), &syntaxErr)
+	// a page without the items is an error rather than an empty page
+	_, client = newTestJSONPagesClient(`{"data":{"items":[{"id":1}]}}`, `{"data":{"error":"bad"}}`)
+	items = nil
+	err = client.DecodePages(req, "data.items", &items)
+	assert.True(errors.Is(err, ErrItemsPathNotFound))
+	assert.EqualError(err, `httpclient: items path not found: "data.items" on page 2`)
+	assert.Equal([]testItem{{1}}, items)
+}
+
+func TestJSONPath(t *testing.T) {
+	assert := assert.New(t)
+	v, ok := jsonPath(json.RawMessage(`{"a":{"b":[1]}}`), "a.b")
+	assert.True(ok)
+	assert.Equal("[1]", string(v))
+	_, ok = jsonPath(json.RawMessage(`{"a":{"b":null}}`), "a.b")
+	assert.False(ok)
+	v, ok = lookupJSON(json.RawMessage(`{"a":{"b":null}}`), "a.b")
+	assert.True(ok)
+	assert.Equal("null", string(v))
+	_, ok = lookupJSON(json.RawMessage(`{"a":{}}`), "a.b")
+	assert.False(ok)
+	_, ok = jsonPath(json.RawMessage(`{"a":1}`), "a.b")
+	assert.False(ok)
+	v, ok = jsonPath(json.RawMessage(`[1]`), "")
+	assert.True(ok)
+	assert.Equal("[1]", string(v))
+}
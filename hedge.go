@@ -0,0 +1,254 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type fixedHedger struct {
+	delay time.Duration
+}
+
+// make sure it implements the interface
+var _ Hedger = (*fixedHedger)(nil)
+
+func (h *fixedHedger) HedgeDelay(req *http.Request) (time.Duration, bool) {
+	return h.delay, isHedgeable(req)
+}
+
+func (h *fixedHedger) Observe(req *http.Request, latency time.Duration) {
+}
+
+// NewHedger returns a Hedger which sends a duplicate attempt of an idempotent request (GET, HEAD or
+// OPTIONS without a body) when there's no response after the delay
+func NewHedger(delay time.Duration) Hedger {
+	return &fixedHedger{delay}
+}
+
+// DefaultHedgeWindow is the number of latencies kept for each host by the Hedger returned by
+// NewPercentileHedger when the window passed in isn't greater than zero
+const DefaultHedgeWindow = 100
+
+type latencies struct {
+	samples []time.Duration
+	next    int
+}
+
+type percentileHedger struct {
+	percentile float64
+	window     int
+	initial    time.Duration
+	mu         sync.Mutex
+	hosts      map[string]*latencies
+}
+
+// make sure it implements the interface
+var _ Hedger = (*percentileHedger)(nil)
+
+func (h *percentileHedger) HedgeDelay(req *http.Request) (time.Duration, bool) {
+	if !isHedgeable(req) {
+		return 0, false
+	}
+	h.mu.Lock()
+	l := h.hosts[HostKey(req)]
+	if l == nil || len(l.samples) < h.window {
+		h.mu.Unlock()
+		// not enough samples to learn from yet
+		return h.initial, true
+	}
+	samples := append([]time.Duration(nil), l.samples...)
+	h.mu.Unlock()
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	// use the nearest rank
+	i := int(math.Ceil(float64(len(samples))*h.percentile)) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(samples) {
+		i = len(samples) - 1
+	}
+	return samples[i], true
+}
+
+func (h *percentileHedger) Observe(req *http.Request, latency time.Duration) {
+	key := HostKey(req)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	l := h.hosts[key]
+	if l == nil {
+		l = &latencies{}
+		h.hosts[key] = l
+	}
+	if len(l.samples) < h.window {
+		l.samples = append(l.samples, latency)
+		return
+	}
+	l.samples[l.next] = latency
+	l.next = (l.next + 1) % h.window
+}
+
+// NewPercentileHedger returns a Hedger which sends a duplicate attempt of an idempotent request
+// (GET, HEAD or OPTIONS without a body) when there's no response after the percentile (such as 0.95)
+// of the latencies of the last window responses from the host. Until there are window responses
+// the initial delay is used.
+func NewPercentileHedger(percentile float64, window int, initial time.Duration) Hedger {
+	if window <= 0 {
+		window = DefaultHedgeWindow
+	}
+	return &percentileHedger{
+		percentile: percentile,
+		window:     window,
+		initial:    initial,
+		hosts:      make(map[string]*latencies),
+	}
+}
+
+// isHedgeable returns true if the request can safely be sent twice at the same time
+func isHedgeable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return req.Body == nil || req.Body == http.NoBody
+	}
+	return false
+}
+
+type hedgeResult struct {
+	resp    *http.Response
+	err     error
+	latency time.Duration
+	cancel  context.CancelFunc
+	attempt int
+	// skipped is true when the duplicate attempt wasn't sent since it couldn't get past the
+	// RateLimiter or the Bulkhead in time
+	skipped bool
+}
+
+// discard cancels the attempt and drains and closes the body so the connection can be reused
+func (r *hedgeResult) discard() {
+	r.cancel()
+	if r.resp != nil && r.resp.Body != nil {
+		io.Copy(ioutil.Discard, r.resp.Body)
+		r.resp.Body.Close()
+	}
+}
+
+// hedge will send the request and, if there's no response after the delay, a duplicate of the
+// request returning the first successful response. The slower attempt is cancelled and drained.
+// The duplicate waits on the RateLimiter and takes its own Bulkhead slot like any other attempt.
+func (c *HTTPClient) hedge(req *http.Request, delay time.Duration) (*http.Response, error) {
+	ctx := req.Context()
+	results := make(chan *hedgeResult, 2)
+	var cancels []context.CancelFunc
+	send := func() {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		attempt := len(cancels)
+		cancels = append(cancels, cancel)
+		go func() {
+			var release func()
+			if attempt > 0 {
+				var err error
+				if release, err = c.acquireHedge(attemptCtx, req); err != nil {
+					results <- &hedgeResult{err: err, cancel: cancel, attempt: attempt, skipped: true}
+					return
+				}
+			}
+			started := time.Now()
+			// each attempt gets its own copy since a Client or Middleware may change the headers
+			resp, err := c.c.Do(req.Clone(attemptCtx))
+			if release != nil {
+				if resp != nil && resp.Body != nil {
+					resp.Body = &releaseBody{resp.Body, release}
+				} else {
+					release()
+				}
+			}
+			results <- &hedgeResult{resp, err, time.Since(started), cancel, attempt, false}
+		}()
+	}
+	send()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	inflight := 1
+	var failure *hedgeResult
+	for {
+		select {
+		case <-timer.C:
+			if Debug {
+				fmt.Printf("httpclient: Do hedging request %v after %v\n", req.URL, delay)
+			}
+			inflight++
+			send()
+		case result := <-results:
+			inflight--
+			if result.skipped {
+				result.cancel()
+				if inflight > 0 {
+					continue
+				}
+				// the other attempt already failed
+				return hedgeResponse(failure)
+			}
+			if (result.resp != nil || result.err != nil) && attemptResult(ctx, result.resp, result.err) != CircuitFailure {
+				if result.err == nil {
+					c.config.Hedger.Observe(req, result.latency)
+				}
+				if failure != nil {
+					failure.discard()
+				}
+				if inflight > 0 {
+					// cancel the slower attempt and drain it in the background
+					for i, cancel := range cancels {
+						if i != result.attempt {
+							cancel()
+						}
+					}
+					go func() {
+						(<-results).discard()
+					}()
+				}
+				return hedgeResponse(result)
+			}
+			if inflight > 0 {
+				// wait for the other attempt in case it succeeds
+				failure = result
+				continue
+			}
+			if failure != nil {
+				// both attempts failed so use the first failure
+				result.discard()
+				result = failure
+			}
+			return hedgeResponse(result)
+		}
+	}
+}
+
+// acquireHedge waits on the RateLimiter and for a Bulkhead slot before sending a duplicate attempt,
+// returning the func to release the slot if one was taken
+func (c *HTTPClient) acquireHedge(ctx context.Context, req *http.Request) (func(), error) {
+	if c.config.RateLimiter != nil {
+		if err := c.config.RateLimiter.Wait(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	if c.config.Bulkhead != nil {
+		return c.config.Bulkhead.Acquire(ctx, req)
+	}
+	return nil, nil
+}
+
+// hedgeResponse returns the response of the attempt, cancelling its context once the body is closed
+func hedgeResponse(result *hedgeResult) (*http.Response, error) {
+	if result.resp != nil && result.resp.Body != nil {
+		result.resp.Body = &cancelBody{result.resp.Body, result.cancel}
+	} else {
+		result.cancel()
+	}
+	return result.resp, result.err
+}
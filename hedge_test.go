@@ -0,0 +1,192 @@
+package httpclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testHedgeClient struct {
+	mu        sync.Mutex
+	count     int
+	delay     map[int]time.Duration
+	status    map[int]int
+	cancelled chan int
+}
+
+func (c *testHedgeClient) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.count++
+	n := c.count
+	c.mu.Unlock()
+	select {
+	case <-req.Context().Done():
+		c.cancelled <- n
+		return nil, req.Context().Err()
+	case <-time.After(c.delay[n]):
+	}
+	status := http.StatusOK
+	if c.status[n] != 0 {
+		status = c.status[n]
+	}
+	return &http.Response{StatusCode: status, Request: req, Body: ioutil.NopCloser(strings.NewReader(strings.Repeat("x", n)))}, nil
+}
+
+func (c *testHedgeClient) attempts() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count
+}
+
+func newTestHedgeClient(hedger Hedger, delay map[int]time.Duration, status map[int]int) (*testHedgeClient, *HTTPClient) {
+	tc := &testHedgeClient{delay: delay, status: status, cancelled: make(chan int, 2)}
+	config := NewConfig()
+	config.Hedger = hedger
+	client := NewHTTPClient(nil, config, ClientFunc(tc.Do))
+	return tc, client
+}
+
+func TestDoHedge(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestHedgeClient(NewHedger(5*time.Millisecond), map[int]time.Duration{1: time.Second}, nil)
+	started := time.Now()
+	resp, err := client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.True(time.Since(started) < time.Second)
+	// the slow attempt is cancelled but not the one which is used
+	assert.Equal(1, <-tc.cancelled)
+	assert.NoError(resp.Request.Context().Err())
+	buf, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal("xx", string(buf))
+	assert.Error(resp.Request.Context().Err())
+	assert.Equal(2, tc.attempts())
+}
+
+func TestDoHedgeNotNeeded(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestHedgeClient(NewHedger(50*time.Millisecond), nil, nil)
+	resp, err := client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(1, tc.attempts())
+	// only idempotent requests are hedged
+	tc, client = newTestHedgeClient(NewHedger(time.Millisecond), map[int]time.Duration{1: 20 * time.Millisecond}, nil)
+	resp, err = client.Post("https://foo.com/bar", "text/plain", strings.NewReader("body"))
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(1, tc.attempts())
+}
+
+func TestDoHedgeFailure(t *testing.T) {
+	assert := assert.New(t)
+	// the first attempt fails after the hedge was sent so the hedge is used
+	delay := map[int]time.Duration{1: 20 * time.Millisecond, 2: 40 * time.Millisecond}
+	tc, client := newTestHedgeClient(NewHedger(5*time.Millisecond), delay, map[int]int{1: http.StatusBadGateway})
+	resp, err := client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(2, tc.attempts())
+	// both fail so the first failure is returned
+	tc, client = newTestHedgeClient(NewHedger(5*time.Millisecond), delay, map[int]int{1: http.StatusBadGateway, 2: http.StatusServiceUnavailable})
+	resp, err = client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(2, tc.attempts())
+	// a failure before the hedge delay is returned without hedging
+	tc, client = newTestHedgeClient(NewHedger(50*time.Millisecond), nil, map[int]int{1: http.StatusBadGateway})
+	resp, err = client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(http.StatusBadGateway, resp.StatusCode)
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(1, tc.attempts())
+}
+
+func TestPercentileHedger(t *testing.T) {
+	assert := assert.New(t)
+	h := NewPercentileHedger(0.9, 10, time.Second)
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	other, _ := http.NewRequest(http.MethodGet, "https://other.com/bar", nil)
+	delay, ok := h.HedgeDelay(req)
+	assert.True(ok)
+	assert.Equal(time.Second, delay)
+	for i := 1; i <= 10; i++ {
+		h.Observe(req, time.Duration(i)*time.Millisecond)
+	}
+	delay, _ = h.HedgeDelay(req)
+	assert.Equal(9*time.Millisecond, delay)
+	// the oldest latencies are replaced
+	for i := 1; i <= 9; i++ {
+		h.Observe(req, time.Millisecond)
+	}
+	delay, _ = h.HedgeDelay(req)
+	assert.Equal(time.Millisecond, delay)
+	delay, _ = h.HedgeDelay(other)
+	assert.Equal(time.Second, delay)
+	post, _ := http.NewRequest(http.MethodPost, "https://foo.com/bar", strings.NewReader("body"))
+	_, ok = h.HedgeDelay(post)
+	assert.False(ok)
+}
+
+func TestDoHedgeLimits(t *testing.T) {
+	assert := assert.New(t)
+	delay := map[int]time.Duration{1: 30 * time.Millisecond}
+	// the rate limiter allows a single request so the duplicate isn't sent
+	tc, client := newTestHedgeClient(NewHedger(5*time.Millisecond), delay, nil)
+	client.config.RateLimiter = NewRateLimiter(RateLimiterConfig{Rate: 0.001})
+	resp, err := client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(1, tc.attempts())
+	// there's no free bulkhead slot for the duplicate
+	tc, client = newTestHedgeClient(NewHedger(5*time.Millisecond), delay, nil)
+	client.config.Bulkhead = NewBulkhead(BulkheadConfig{MaxInFlight: 1})
+	resp, err = client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(1, tc.attempts())
+	// the duplicate takes its own slot which is released with the response
+	tc, client = newTestHedgeClient(NewHedger(5*time.Millisecond), map[int]time.Duration{1: time.Second}, nil)
+	bulkhead := NewBulkhead(BulkheadConfig{MaxInFlight: 2})
+	client.config.Bulkhead = bulkhead
+	resp, err = client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(2, tc.attempts())
+	assert.Equal(1, <-tc.cancelled)
+	resp.Body.Close()
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	for i := 0; i < 2; i++ {
+		_, err := bulkhead.Acquire(context.Background(), req)
+		assert.NoError(err)
+	}
+}
+
+func TestDoHedgeMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testHedgeClient{delay: map[int]time.Duration{1: time.Second}, cancelled: make(chan int, 2)}
+	config := NewConfig()
+	config.Hedger = NewHedger(time.Millisecond)
+	config.Middleware = []Middleware{func(next Client) Client {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			// change the header in place, which must not race with the other attempt
+			req.Header.Set("X-Attempt", "1")
+			req.Header.Get("Authorization")
+			return next.Do(req)
+		})
+	}}
+	client := NewHTTPClient(nil, config, ClientFunc(tc.Do))
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	resp, err := client.Do(req)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(1, <-tc.cancelled)
+	assert.Empty(req.Header.Get("X-Attempt"))
+}
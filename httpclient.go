@@ -1,6 +1,7 @@
 package httpclient
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -24,6 +25,10 @@ var ErrInvalidClientImpl = errors.New("httpclient: invalid response from Do")
 // this is a catch all that will prevent a Retryable going over a predefined threshold in case it has a bug
 const maxAttempts = 100
 
+// DefaultMaxErrorBodySize is the maximum number of bytes of a response body captured in an HTTPError
+// when Config.MaxErrorBodySize isn't set
+const DefaultMaxErrorBodySize = 64 * 1024
+
 // HTTPError is a struct which carries HTTP error details
 type HTTPError struct {
 	Body       []byte
@@ -36,17 +41,99 @@ func (h *HTTPError) Error() string {
 	return fmt.Sprintf("HTTP Error (%d/%v)", h.StatusCode, h.URL)
 }
 
+// Attempt is the outcome of a single attempt of a request
+type Attempt struct {
+	StatusCode int
+	Err        error
+	Duration   time.Duration
+}
+
+// RetryExhaustedError is returned by Do when the retries are exhausted. It matches
+// ErrRequestTimeout with errors.Is and unwraps to the last failure, which is an *HTTPError
+// when the last attempt returned a response.
+type RetryExhaustedError struct {
+	Attempts  int
+	Elapsed   time.Duration
+	LastDelay time.Duration
+	History   []Attempt
+	Err       error
+}
+
+func (e *RetryExhaustedError) Error() string {
+	msg := fmt.Sprintf("%v after %d attempts in %v", ErrRequestTimeout, e.Attempts, e.Elapsed)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is returns true if the target is ErrRequestTimeout
+func (e *RetryExhaustedError) Is(target error) bool {
+	return target == ErrRequestTimeout
+}
+
+// Unwrap returns the last failure
+func (e *RetryExhaustedError) Unwrap() error {
+	return e.Err
+}
+
 // Config is the configuration for the HTTPClient
 type Config struct {
-	Paginator Paginator
-	Retryable Retryable
+	Paginator    Paginator
+	Retryable    Retryable
+	StatusPolicy StatusPolicy
+	// MaxBodyBufferSize when greater than zero will buffer a request body which can't otherwise
+	// be replayed (it has no GetBody and isn't an io.Seeker) in memory up to this size so that it
+	// can be sent again on a retry. Bodies larger than this are sent once and not retried.
+	MaxBodyBufferSize int64
+	// HTTPErrors when true will return an *HTTPError instead of the response when the final
+	// response isn't a 2xx, including the last response after the retries are exhausted
+	HTTPErrors bool
+	// MaxErrorBodySize is the maximum number of bytes of the response body captured in an
+	// HTTPError, defaults to DefaultMaxErrorBodySize
+	MaxErrorBodySize int64
+	// MaxPages is the maximum number of pages fetched for a request, unlimited when zero
+	MaxPages int
+	// MaxPaginationBytes is the maximum number of bytes of the pages buffered by Do, unlimited when zero
+	MaxPaginationBytes int64
+	// MaxPaginationDuration is the maximum time spent fetching the pages of a request, unlimited when zero
+	MaxPaginationDuration time.Duration
+	// TruncatePagination when true will stop at a pagination limit and have Do return the pages
+	// fetched so far along with the *PaginationLimitError, whose Checkpoint can be used to fetch the
+	// rest. The body is empty when the first page alone is over MaxPaginationBytes. A PageIterator
+	// stops without an error and reports Truncated instead.
+	TruncatePagination bool
+	// PrefetchConcurrency when greater than one and the Paginator implements RangePaginator will
+	// fetch the remaining pages concurrently, at most this many at a time, once the first page
+	// tells the total number of pages. Each page is retried with the Retryable.
+	PrefetchConcurrency int
+	// Middleware is applied in order around the Client for each attempt of a request, including
+	// the retries and the requests for each page, the first middleware being the outermost
+	Middleware []Middleware
+	// CircuitBreaker when set is checked before each attempt of a request and is told the outcome
+	// of the attempt: a temporary error or a 5xx response is a failure while any other response is a
+	// success. A cancelled attempt, a permanent error or a 429 response is ignored.
+	// A request whose circuit is open fails with an error matching ErrCircuitOpen without being retried.
+	CircuitBreaker CircuitBreaker
+	// RateLimiter when set is waited on before each attempt of a request, including the retries
+	// and the requests for each page. It's passed each response if it implements ResponseObserver.
+	RateLimiter RateLimiter
+	// Bulkhead when set limits the number of requests in flight. A slot is taken for each attempt
+	// and held until the response body is closed. A request which doesn't get a slot fails
+	// with ErrBulkheadFull or ErrBulkheadTimeout without being retried.
+	Bulkhead Bulkhead
+	// Hedger when set sends a duplicate attempt of an idempotent request when there's no response
+	// in time, using the first successful response and cancelling the other. The duplicate waits on
+	// the RateLimiter and takes its own Bulkhead slot, and it isn't sent if it doesn't get one in time.
+	Hedger Hedger
 }
 
 // NewConfig returns an empty Config by no pagination and no retry
 func NewConfig() *Config {
 	return &Config{
-		Paginator: &noPaginator{},
-		Retryable: &noRetry{},
+		Paginator:    &noPaginator{},
+		Retryable:    &noRetry{},
+		StatusPolicy: DefaultStatusPolicy(),
 	}
 }
 
@@ -71,6 +158,9 @@ func NewHTTPClientDefault() *HTTPClient {
 
 // NewHTTPClient returns a configured HTTPClient instance
 func NewHTTPClient(ctx context.Context, config *Config, client Client) *HTTPClient {
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	if config == nil {
 		config = NewConfig()
 	}
@@ -83,10 +173,13 @@ func NewHTTPClient(ctx context.Context, config *Config, client Client) *HTTPClie
 	if config.Retryable == nil {
 		config.Retryable = NewNoRetry()
 	}
+	if config.StatusPolicy == nil {
+		config.StatusPolicy = DefaultStatusPolicy()
+	}
 	return &HTTPClient{
 		config: config,
 		ctx:    ctx,
-		c:      client,
+		c:      Chain(client, config.Middleware...),
 	}
 }
 
@@ -102,6 +195,15 @@ func (c *HTTPClient) Get(url string) (*http.Response, error) {
 	return c.Do(req)
 }
 
+// GetContext is a convenience method for making a Get request to a url with a context
+func (c *HTTPClient) GetContext(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.DoContext(ctx, req)
+}
+
 // Post is a convenience method for making a Post request to a url
 func (c *HTTPClient) Post(url string, contentType string, body io.Reader) (*http.Response, error) {
 	req, err := http.NewRequest(http.MethodPost, url, body)
@@ -112,100 +214,335 @@ func (c *HTTPClient) Post(url string, contentType string, body io.Reader) (*http
 	return c.Do(req)
 }
 
-// Do will invoke the http request
+// PostContext is a convenience method for making a Post request to a url with a context
+func (c *HTTPClient) PostContext(ctx context.Context, url string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.DoContext(ctx, req)
+}
+
+// Do will invoke the http request. The request is cancelled when either the context of the
+// request or the context of the HTTPClient is done.
 func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
-	var count, page int
+	return c.DoContext(req.Context(), req)
+}
+
+// DoContext will invoke the http request with the context, which replaces the context of the
+// request. The request is cancelled when either ctx or the context of the HTTPClient is done.
+func (c *HTTPClient) DoContext(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return c.doFrom(ctx, req, 1)
+}
+
+// DoFrom will resume a paginated request from the Checkpoint, using req for the headers and context
+func (c *HTTPClient) DoFrom(req *http.Request, cp *Checkpoint) (*http.Response, error) {
+	req, err := cp.Request(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.doFrom(req.Context(), req, cp.Page)
+}
+
+func (c *HTTPClient) doFrom(ctx context.Context, req *http.Request, page int) (*http.Response, error) {
+	ctx, cancel := mergeContext(ctx, c.ctx)
+	pages := c.pages(req.WithContext(ctx))
+	pages.page = page - 1
+	resp, err := c.do(pages)
+	if cancel != nil {
+		if resp != nil && resp.Body != nil {
+			// the body is still to be read so wait for it to be closed
+			resp.Body = &cancelBody{resp.Body, cancel}
+		} else {
+			cancel()
+		}
+	}
+	return resp, err
+}
+
+func (c *HTTPClient) do(pages *PageIterator) (*http.Response, error) {
 	var streams *multiReader
+	var last *http.Response
+	ctx := pages.ctx
+	// add the page to the streams, returning false when the bytes limit is reached. The body is
+	// read unless it's already in memory.
+	add := func(resp *http.Response, body []byte, page int, req *http.Request) (bool, error) {
+		if resp.Body == nil {
+			return true, nil
+		}
+		// remember our stream since we're going to need to return it instead
+		var err error
+		if body != nil {
+			err = streams.AddBytes(body)
+		} else {
+			err = streams.Add(ctx, resp.Body)
+		}
+		if err != nil {
+			if err != errStreamLimit {
+				return false, pages.contextError(err)
+			}
+			pages.checkpoint = newCheckpoint(page, req)
+			if !c.config.TruncatePagination {
+				return false, pages.limitError("bytes", streams.size)
+			}
+			pages.truncated = true
+			pages.limit = "bytes"
+			return false, nil
+		}
+		return true, nil
+	}
+	var first *http.Response
+	for pages.Next() {
+		resp := pages.Response()
+		if first == nil {
+			first = resp
+		}
+		if streams == nil {
+			if pages.next == nil {
+				// a single page so return it as-is
+				return resp, nil
+			}
+			streams = newMuliReader()
+			streams.max = c.config.MaxPaginationBytes
+		}
+		ok, err := add(resp, nil, pages.page, pages.req)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		last = resp
+		if len(pages.ranged) > 0 {
+			// fetch the rest of the pages concurrently instead of one at a time
+			reqs := pages.ranged
+			var limit string
+			if remaining := c.config.MaxPages - pages.fetched; c.config.MaxPages > 0 && len(reqs) > remaining {
+				if remaining < 0 {
+					remaining = 0
+				}
+				reqs = reqs[:remaining]
+				limit = "pages"
+			}
+			budget := int64(-1)
+			if c.config.MaxPaginationBytes > 0 {
+				budget = c.config.MaxPaginationBytes - streams.size
+			}
+			resps, bodies, err := c.prefetch(ctx, reqs, pages.page+1, pages.started, budget)
+			if err == errPrefetchDuration {
+				limit, err = "duration", nil
+			} else if err != nil || len(resps) < len(reqs) || (len(resps) > 0 && resps[len(resps)-1].StatusCode != http.StatusOK) {
+				// stopped before the limit
+				limit = ""
+			}
+			for i, resp := range resps {
+				ok, err := add(resp, bodies[i], pages.page+1+i, pages.ranged[i])
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					limit = ""
+					break
+				}
+				pages.fetched++
+				last = resp
+			}
+			if err != nil {
+				return nil, err
+			}
+			if limit != "" {
+				pages.checkpoint = newCheckpoint(pages.page+1+len(resps), pages.ranged[len(resps)])
+				if !c.config.TruncatePagination {
+					return nil, pages.limitError(limit, streams.size)
+				}
+				pages.truncated = true
+				pages.limit = limit
+			}
+			break
+		}
+	}
+	if err := pages.Err(); err != nil {
+		if limitErr, ok := err.(*PaginationLimitError); ok && streams != nil {
+			limitErr.Bytes = streams.size
+		}
+		return nil, err
+	}
+	if pages.truncated {
+		// return the pages which were kept along with the error so the caller can tell they aren't
+		// all of them, using the first page when it was over the bytes limit by itself
+		resp := last
+		if resp == nil {
+			resp = first
+		}
+		resp.Body = streams
+		return resp, pages.limitError(pages.limit, streams.size)
+	}
+	last.Body = streams
+	return last, nil
+}
+
+// paginate returns the request for the next page if the response has more pages
+func (c *HTTPClient) paginate(page int, req *http.Request, resp *http.Response) (bool, *http.Request) {
+	// if OK and a GET (or another method the paginator supports) request type, see if we need to paginate
+	if resp.StatusCode == http.StatusOK && c.paginatesMethod(req.Method) {
+		return c.config.Paginator.HasMore(page, req, resp)
+	}
+	return false, nil
+}
+
+func (c *HTTPClient) paginatesMethod(method string) bool {
+	if p, ok := c.config.Paginator.(MethodPaginator); ok {
+		return p.PaginateMethod(method)
+	}
+	return method == http.MethodGet
+}
+
+// send will invoke a single request (one page), retrying it as needed
+func (c *HTTPClient) send(req *http.Request, page int) (*http.Response, error) {
+	var count int
+	var history []Attempt
+	var delay time.Duration
 	started := time.Now()
 	maxDuration := c.config.Retryable.RetryMaxDuration()
-	req = req.WithContext(c.ctx)
+	ctx := req.Context()
+	closer, err := c.setBodyRewind(req)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
 	if Debug {
 		fmt.Printf("httpclient: Do starting %v with maxDuration=%v\n", req.URL, maxDuration)
 	}
 	for time.Since(started) < maxDuration && count+1 < maxAttempts {
+		var last *http.Response
 		count++
-		page++
+		if err := ctx.Err(); err != nil {
+			return nil, contextError(req, count, err)
+		}
+		if count > 1 && req.GetBody != nil {
+			// rewind the body since the previous attempt consumed it
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
 		if Debug {
 			fmt.Printf("httpclient: Do sending request %v, count=%d, page=%d\n", req.URL, count, page)
 		}
-		resp, err := c.c.Do(req)
+		// check the circuit first so a request whose circuit is open fails without waiting
+		var done func(result CircuitResult)
+		if c.config.CircuitBreaker != nil {
+			if done, err = c.config.CircuitBreaker.Allow(req); err != nil {
+				return nil, err
+			}
+		}
+		if c.config.RateLimiter != nil {
+			if err := c.config.RateLimiter.Wait(ctx, req); err != nil {
+				if done != nil {
+					done(CircuitIgnore)
+				}
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return nil, contextError(req, count, ctxErr)
+				}
+				return nil, err
+			}
+		}
+		var release func()
+		if c.config.Bulkhead != nil {
+			if release, err = c.config.Bulkhead.Acquire(ctx, req); err != nil {
+				if done != nil {
+					done(CircuitIgnore)
+				}
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return nil, contextError(req, count, ctxErr)
+				}
+				return nil, err
+			}
+		}
+		attemptStarted := time.Now()
+		resp, err := c.attempt(req)
 		if resp == nil && err == nil {
+			if release != nil {
+				release()
+			}
+			if done != nil {
+				done(CircuitFailure)
+			}
 			return nil, ErrInvalidClientImpl
 		}
+		if release != nil {
+			if resp != nil && resp.Body != nil {
+				// hold the slot until the body has been read and closed
+				resp.Body = &releaseBody{resp.Body, release}
+			} else {
+				release()
+			}
+		}
+		if done != nil {
+			done(attemptResult(ctx, resp, err))
+		}
+		if observer, ok := c.config.RateLimiter.(ResponseObserver); ok && resp != nil {
+			observer.Observe(req, resp)
+		}
+		attempt := Attempt{Err: err, Duration: time.Since(attemptStarted)}
 		if err != nil {
 			if Debug {
 				fmt.Printf("httpclient: Do result %v returned, err=%v\n", req.URL, err)
 			}
-			if !c.config.Retryable.RetryError(err) {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, contextError(req, count, ctxErr)
+			}
+			if !canReplay(req) || !c.config.Retryable.RetryError(err) {
 				return nil, err
 			}
 		} else {
 			if Debug {
 				fmt.Printf("httpclient: Do result %v returned, status=%v\n", req.URL, resp.StatusCode)
 			}
-			// if OK and a GET request type, see if we need to paginate
-			if resp.StatusCode == http.StatusOK && req.Method == http.MethodGet {
-				if ok, newreq := c.config.Paginator.HasMore(page, req, resp); ok {
-					// reset our count and timestamp since we're going to loop and it's OK
-					count = 0
-					started = time.Now()
-					if streams == nil {
-						streams = newMuliReader()
-					}
-					// remember our stream since we're going to need to return it instead
-					if err := streams.Add(resp.Body); err != nil {
-						req.Close = true
-						return nil, err
-					}
-					// don't reuse this request again
-					req.Close = true
-					// assign our new request for the loop
-					req = newreq
-					continue
-				}
-			}
 			// if this request looks like a normal, non-retryable response
 			// then just return it without attempting a retry
-			if (resp.StatusCode >= 200 && resp.StatusCode < 300) ||
-				resp.StatusCode == http.StatusUnauthorized ||
-				resp.StatusCode == http.StatusPaymentRequired ||
-				resp.StatusCode == http.StatusForbidden ||
-				resp.StatusCode == http.StatusNotFound ||
-				resp.StatusCode == http.StatusMethodNotAllowed ||
-				resp.StatusCode == http.StatusPermanentRedirect ||
-				resp.StatusCode == http.StatusTemporaryRedirect ||
-				resp.StatusCode == http.StatusConflict ||
-				resp.StatusCode == http.StatusRequestEntityTooLarge ||
-				resp.StatusCode == http.StatusRequestedRangeNotSatisfiable ||
-				resp.StatusCode == http.StatusRequestHeaderFieldsTooLarge ||
-				resp.StatusCode == http.StatusBadRequest ||
-				resp.StatusCode == http.StatusUnprocessableEntity ||
-				resp.StatusCode == http.StatusInternalServerError {
-				// check to see if we have a multiple stream response (pagination)
-				if streams != nil && resp.Body != nil {
-					streams.Add(resp.Body)
-					resp.Body = streams
-				}
-				return resp, nil
+			if c.terminal(resp) {
+				return c.result(req, resp)
 			}
-			if !c.config.Retryable.RetryResponse(resp) {
-				return resp, nil
+			if !canReplay(req) || !c.config.Retryable.RetryResponse(resp) {
+				return c.result(req, resp)
+			}
+			attempt.StatusCode = resp.StatusCode
+			if c.config.HTTPErrors {
+				// keep the error details in case this ends up being the final response
+				attempt.Err = c.newHTTPError(req, resp)
+			} else {
+				attempt.Err = &HTTPError{StatusCode: resp.StatusCode, URL: req.URL, Headers: resp.Header}
+				// make sure we read all (if any) content and close the response stream as to not leak resources
+				if resp.Body != nil {
+					ioutil.ReadAll(resp.Body)
+					resp.Body.Close()
+				}
 			}
-			// make sure we read all (if any) content and close the response stream as to not leak resources
-			if resp.Body != nil {
-				ioutil.ReadAll(resp.Body)
-				resp.Body.Close()
+			last = resp
+		}
+		history = append(history, attempt)
+		duration := c.retryDelay(count, delay, last)
+		if last != nil && duration >= maxDuration-time.Since(started) {
+			// don't wait out the rest of the budget for the delay the server asked for only to give up
+			if _, ok := RetryAfter(last); ok {
+				delay = duration
+				break
 			}
 		}
-		duration := c.config.Retryable.RetryDelay(count)
 		if duration > 0 {
 			remaining := math.Min(float64(maxDuration-time.Since(started)), float64(duration))
+			delay = time.Duration(remaining)
 			if Debug {
 				fmt.Printf("httpclient: Do retry %v duration=%v, remaining=%v\n", req.URL, duration, remaining)
 			}
 			select {
-			case <-c.ctx.Done():
-				return nil, context.Canceled
+			case <-ctx.Done():
+				return nil, contextError(req, count, ctx.Err())
 			case <-time.After(time.Duration(remaining)):
 				continue
 			}
@@ -214,5 +551,150 @@ func (c *HTTPClient) Do(req *http.Request) (*http.Response, error) {
 	if Debug {
 		fmt.Printf("httpclient: Do timed out %v after %v\n", req.URL, time.Since(started))
 	}
-	return nil, ErrRequestTimeout
+	exhausted := &RetryExhaustedError{
+		Attempts:  len(history),
+		Elapsed:   time.Since(started),
+		LastDelay: delay,
+		History:   history,
+	}
+	if len(history) > 0 {
+		exhausted.Err = history[len(history)-1].Err
+	}
+	return nil, exhausted
+}
+
+// terminal returns true if the response is returned as-is without attempting a retry, passing the
+// response to the StatusPolicy if it implements ResponseStatusPolicy
+func (c *HTTPClient) terminal(resp *http.Response) bool {
+	if p, ok := c.config.StatusPolicy.(ResponseStatusPolicy); ok {
+		return p.TerminalResponse(resp)
+	}
+	return c.config.StatusPolicy.Terminal(resp.StatusCode)
+}
+
+// attempt will send the request once, hedging it if the Hedger says so
+func (c *HTTPClient) attempt(req *http.Request) (*http.Response, error) {
+	if c.config.Hedger != nil {
+		if delay, ok := c.config.Hedger.HedgeDelay(req); ok {
+			return c.hedge(req, delay)
+		}
+	}
+	return c.c.Do(req)
+}
+
+// attemptResult returns if the attempt failed because of the upstream, which is a temporary error
+// or a 5xx response. A cancelled request, a permanent error, such as a bad certificate, or a 429 from
+// an upstream which is throttling says nothing about its health.
+func attemptResult(ctx context.Context, resp *http.Response, err error) CircuitResult {
+	if err != nil {
+		if ctx.Err() != nil || !IsTemporaryError(err) {
+			return CircuitIgnore
+		}
+		return CircuitFailure
+	}
+	switch {
+	case resp.StatusCode >= 500:
+		return CircuitFailure
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return CircuitIgnore
+	}
+	return CircuitSuccess
+}
+
+// contextError wraps the error of a done context with the request and attempt details
+func contextError(req *http.Request, attempt int, err error) error {
+	return fmt.Errorf("httpclient: %s %v cancelled on attempt %d: %w", req.Method, req.URL, attempt, err)
+}
+
+// result returns the final response or, when Config.HTTPErrors is set, an *HTTPError in place of a non-2xx response
+func (c *HTTPClient) result(req *http.Request, resp *http.Response) (*http.Response, error) {
+	if !c.config.HTTPErrors || (resp.StatusCode >= 200 && resp.StatusCode < 300) {
+		return resp, nil
+	}
+	return nil, c.newHTTPError(req, resp)
+}
+
+// newHTTPError returns an HTTPError for the response capturing up to Config.MaxErrorBodySize
+// bytes of the body. The rest of the body is discarded and the body is closed.
+func (c *HTTPClient) newHTTPError(req *http.Request, resp *http.Response) *HTTPError {
+	httpErr := &HTTPError{
+		StatusCode: resp.StatusCode,
+		URL:        req.URL,
+		Headers:    resp.Header,
+	}
+	if resp.Body != nil {
+		max := c.config.MaxErrorBodySize
+		if max <= 0 {
+			max = DefaultMaxErrorBodySize
+		}
+		httpErr.Body, _ = ioutil.ReadAll(io.LimitReader(resp.Body, max))
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	return httpErr
+}
+
+// canReplay returns true if the request can be sent again, either because it has no body
+// or because the body can be rewound
+func canReplay(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// setBodyRewind will make sure the request body can be replayed on a retry. Requests created
+// by http.NewRequest with an in-memory body already set GetBody. An io.Seeker body is rewound
+// to its current offset and any other body is buffered when Config.MaxBodyBufferSize allows it.
+// The returned io.Closer, if not nil, must be closed once the request is no longer needed.
+func (c *HTTPClient) setBodyRewind(req *http.Request) (io.Closer, error) {
+	if canReplay(req) {
+		return nil, nil
+	}
+	body := req.Body
+	if seeker, ok := body.(io.Seeker); ok {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			// the transport will close the body after each attempt so we must keep it open
+			// until we're done and close it ourselves
+			req.GetBody = func() (io.ReadCloser, error) {
+				if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+					return nil, err
+				}
+				return ioutil.NopCloser(body), nil
+			}
+			req.Body = ioutil.NopCloser(body)
+			return body, nil
+		}
+	}
+	if c.config.MaxBodyBufferSize <= 0 {
+		return nil, nil
+	}
+	buf, err := ioutil.ReadAll(io.LimitReader(body, c.config.MaxBodyBufferSize+1))
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	if int64(len(buf)) > c.config.MaxBodyBufferSize {
+		// too large to buffer, stream it once with what we've already read
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), body), body}
+		return nil, nil
+	}
+	body.Close()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(buf)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return nil, nil
+}
+
+// retryDelay returns the delay before the next attempt, passing the previous delay and the last
+// response to the Retryable if it implements RequestRetryable or ResponseRetryable
+func (c *HTTPClient) retryDelay(count int, prev time.Duration, resp *http.Response) time.Duration {
+	if r, ok := c.config.Retryable.(RequestRetryable); ok {
+		return r.RetryRequestDelay(count, prev, resp)
+	}
+	if r, ok := c.config.Retryable.(ResponseRetryable); ok {
+		return r.RetryResponseDelay(count, resp)
+	}
+	return c.config.Retryable.RetryDelay(count)
 }
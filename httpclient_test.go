@@ -3,6 +3,7 @@ package httpclient
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -314,8 +315,52 @@ func TestNewHTTPClientRetryCancelled(t *testing.T) {
 	req, err := http.NewRequest(http.MethodGet, "/test", nil)
 	assert.NoError(err)
 	resp, err := client.Do(req)
-	assert.EqualError(err, context.Canceled.Error())
+	assert.True(errors.Is(err, context.Canceled))
+	assert.Equal("httpclient: GET /test cancelled on attempt 1: context canceled", err.Error())
 	assert.Nil(resp)
+	assert.Equal(0, tc.count)
+}
+
+func TestNewHTTPClientRetryDeadlineExceeded(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testClient{
+		resp: &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+		},
+	}
+	config := NewConfig()
+	config.Retryable = NewBackoffRetry(time.Millisecond, 10*time.Millisecond, 10*time.Second, 2)
+	client := NewHTTPClient(context.Background(), config, tc)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	resp, err := client.GetContext(ctx, "/test")
+	assert.Nil(resp)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	assert.False(errors.Is(err, context.Canceled))
+}
+
+func TestNewHTTPClientErrorCancelled(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	tc := &testClient{}
+	tc.err = fmt.Errorf("error")
+	config := NewConfig()
+	config.Retryable = &retry{retryError: true}
+	client := NewHTTPClient(context.Background(), config, &cancelClient{tc, cancel})
+	resp, err := client.GetContext(ctx, "/test")
+	assert.Nil(resp)
+	assert.True(errors.Is(err, context.Canceled))
+}
+
+// cancelClient cancels the context while the attempt is in flight
+type cancelClient struct {
+	*testClient
+	cancel context.CancelFunc
+}
+
+func (c *cancelClient) Do(req *http.Request) (*http.Response, error) {
+	c.cancel()
+	return c.testClient.Do(req)
 }
 
 func TestNewHTTPClientRetryTimeout(t *testing.T) {
@@ -343,8 +388,19 @@ func TestNewHTTPClientRetryTimeout(t *testing.T) {
 	req, err := http.NewRequest(http.MethodGet, "/test", nil)
 	assert.NoError(err)
 	resp, err := client.Do(req)
-	assert.EqualError(err, ErrRequestTimeout.Error())
+	assert.True(errors.Is(err, ErrRequestTimeout))
 	assert.Nil(resp)
+	var exhausted *RetryExhaustedError
+	assert.True(errors.As(err, &exhausted))
+	assert.Equal(1, exhausted.Attempts)
+	assert.Len(exhausted.History, 1)
+	assert.Equal(http.StatusBadGateway, exhausted.History[0].StatusCode)
+	assert.True(exhausted.Elapsed >= time.Second)
+	assert.True(exhausted.LastDelay > 0)
+	var httpErr *HTTPError
+	assert.True(errors.As(err, &httpErr))
+	assert.Equal(http.StatusBadGateway, httpErr.StatusCode)
+	assert.Equal("httpclient: timeout after 1 attempts in "+exhausted.Elapsed.String()+": HTTP Error (502//test)", err.Error())
 }
 
 func TestNewHTTPClientPagination(t *testing.T) {
@@ -435,3 +491,383 @@ func TestBadRequestCall(t *testing.T) {
 	assert.False(paged)
 	assert.Equal(http.StatusBadRequest, resp.StatusCode)
 }
+
+type testClientBodies struct {
+	testClientRetry
+	bodies []string
+}
+
+func (r *testClientBodies) Do(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		buf, _ := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		r.bodies = append(r.bodies, string(buf))
+	}
+	return r.testClientRetry.Do(req)
+}
+
+type onlyReader struct {
+	io.Reader
+}
+
+func newTestClientBodies() *testClientBodies {
+	return &testClientBodies{
+		testClientRetry: testClientRetry{
+			resps: []*http.Response{
+				&http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Body:       &mockBody{},
+				},
+				&http.Response{
+					StatusCode: http.StatusOK,
+					Body:       &testReader{},
+				},
+			},
+		},
+	}
+}
+
+func TestNewHTTPClientRetryPostBody(t *testing.T) {
+	assert := assert.New(t)
+	tc := newTestClientBodies()
+	config := NewConfig()
+	config.Retryable = NewBackoffRetry(time.Millisecond, time.Millisecond, time.Second, 2)
+	client := NewHTTPClient(context.TODO(), config, tc)
+	resp, err := client.Post("/test", "application/json", strings.NewReader(`{"a":1}`))
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal([]string{`{"a":1}`, `{"a":1}`}, tc.bodies)
+}
+
+func TestNewHTTPClientRetrySeekerBody(t *testing.T) {
+	assert := assert.New(t)
+	tc := newTestClientBodies()
+	config := NewConfig()
+	config.Retryable = NewBackoffRetry(time.Millisecond, time.Millisecond, time.Second, 2)
+	client := NewHTTPClient(context.TODO(), config, tc)
+	body := &testSeekBody{Reader: bytes.NewReader([]byte("hello"))}
+	req, err := http.NewRequest(http.MethodPut, "/test", body)
+	assert.NoError(err)
+	resp, err := client.Do(req)
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal([]string{"hello", "hello"}, tc.bodies)
+	assert.True(body.closed)
+}
+
+type testSeekBody struct {
+	*bytes.Reader
+	closed bool
+}
+
+func (b *testSeekBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestNewHTTPClientRetryBufferedBody(t *testing.T) {
+	assert := assert.New(t)
+	tc := newTestClientBodies()
+	config := NewConfig()
+	config.Retryable = NewBackoffRetry(time.Millisecond, time.Millisecond, time.Second, 2)
+	config.MaxBodyBufferSize = 1024
+	client := NewHTTPClient(context.TODO(), config, tc)
+	resp, err := client.Post("/test", "text/plain", onlyReader{strings.NewReader("hello")})
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal([]string{"hello", "hello"}, tc.bodies)
+}
+
+func TestNewHTTPClientRetryBodyNotReplayable(t *testing.T) {
+	assert := assert.New(t)
+	tc := newTestClientBodies()
+	config := NewConfig()
+	config.Retryable = NewBackoffRetry(time.Millisecond, time.Millisecond, time.Second, 2)
+	config.MaxBodyBufferSize = 2
+	client := NewHTTPClient(context.TODO(), config, tc)
+	resp, err := client.Post("/test", "text/plain", onlyReader{strings.NewReader("hello")})
+	assert.NoError(err)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal([]string{"hello"}, tc.bodies)
+}
+
+type responseRetry struct {
+	retry
+	resps []*http.Response
+}
+
+func (r *responseRetry) RetryResponseDelay(retry int, resp *http.Response) time.Duration {
+	r.resps = append(r.resps, resp)
+	return time.Millisecond
+}
+
+func TestNewHTTPClientRetryResponseDelay(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testClientRetry{
+		resps: []*http.Response{
+			&http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": []string{"1"}},
+				Body:       &mockBody{},
+			},
+			&http.Response{
+				StatusCode: http.StatusOK,
+				Body:       &testReader{},
+			},
+		},
+	}
+	config := NewConfig()
+	rr := &responseRetry{retry: retry{retryResponse: true}}
+	config.Retryable = rr
+	client := NewHTTPClient(context.TODO(), config, tc)
+	resp, err := client.Get("/test")
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Len(rr.resps, 1)
+	assert.Equal(tc.resps[0], rr.resps[0])
+}
+
+type requestRetry struct {
+	retry
+	prevs []time.Duration
+}
+
+func (r *requestRetry) RetryRequestDelay(retry int, prev time.Duration, resp *http.Response) time.Duration {
+	r.prevs = append(r.prevs, prev)
+	return time.Duration(retry) * time.Millisecond
+}
+
+func TestNewHTTPClientRetryRequestDelay(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testClientRetry{
+		resps: []*http.Response{
+			&http.Response{StatusCode: http.StatusServiceUnavailable, Body: &mockBody{}},
+			&http.Response{StatusCode: http.StatusServiceUnavailable, Body: &mockBody{}},
+			&http.Response{StatusCode: http.StatusServiceUnavailable, Body: &mockBody{}},
+			&http.Response{StatusCode: http.StatusOK, Body: &testReader{}},
+		},
+	}
+	config := NewConfig()
+	rr := &requestRetry{retry: retry{retryResponse: true}}
+	config.Retryable = rr
+	client := NewHTTPClient(context.TODO(), config, tc)
+	resp, err := client.Get("/test")
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	// each retry gets the delay before the one of the same request
+	assert.Equal([]time.Duration{0, time.Millisecond, 2 * time.Millisecond}, rr.prevs)
+}
+
+func TestNewHTTPClientRetryAfterBudget(t *testing.T) {
+	assert := assert.New(t)
+	var count int
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		count++
+		return &http.Response{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{"Retry-After": []string{"5"}},
+			Body:       ioutil.NopCloser(strings.NewReader("slow down")),
+		}, nil
+	})
+	config := NewConfig()
+	config.Retryable = NewRetryAfterRetry(NewBackoffRetry(time.Millisecond, time.Millisecond, 500*time.Millisecond, 1))
+	client := NewHTTPClient(context.Background(), config, tc)
+	// the server won't take another attempt before the budget is spent so give up right away
+	started := time.Now()
+	resp, err := client.Get("/test")
+	assert.Nil(resp)
+	var exhausted *RetryExhaustedError
+	assert.True(errors.As(err, &exhausted))
+	assert.Equal(1, exhausted.Attempts)
+	assert.Equal(1, count)
+	assert.Equal(500*time.Millisecond, exhausted.LastDelay)
+	assert.True(time.Since(started) < 100*time.Millisecond)
+}
+
+func TestNewHTTPClientStatusPolicy(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testClientRetry{
+		resps: []*http.Response{
+			&http.Response{
+				StatusCode: http.StatusInternalServerError,
+				Body:       &mockBody{},
+			},
+			&http.Response{
+				StatusCode: http.StatusOK,
+				Body:       &testReader{},
+			},
+		},
+	}
+	config := NewConfig()
+	config.Retryable = NewBackoffRetry(time.Millisecond, time.Millisecond, time.Second, 2)
+	config.StatusPolicy = RetryStatusCodes(DefaultStatusPolicy(), http.StatusInternalServerError)
+	client := NewHTTPClient(context.TODO(), config, tc)
+	resp, err := client.Get("/test")
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(2, tc.count)
+}
+
+func TestNewHTTPClientHTTPErrors(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testClient{}
+	config := NewConfig()
+	config.HTTPErrors = true
+	config.MaxErrorBodySize = 5
+	client := NewHTTPClient(context.TODO(), config, tc)
+	body := &testReader{buf: *bytes.NewBufferString("not found at all")}
+	tc.resp = &http.Response{
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{"X-Test": []string{"1"}},
+		Body:       body,
+	}
+	resp, err := client.Get("/test")
+	assert.Nil(resp)
+	var httpErr *HTTPError
+	assert.True(errors.As(err, &httpErr))
+	assert.Equal(http.StatusNotFound, httpErr.StatusCode)
+	assert.Equal("not f", string(httpErr.Body))
+	assert.Equal("/test", httpErr.URL.String())
+	assert.Equal("1", httpErr.Headers.Get("X-Test"))
+	assert.Equal(0, body.buf.Len())
+	assert.True(body.closed)
+	assert.EqualError(err, "HTTP Error (404//test)")
+	tc.resp = &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       &testReader{},
+	}
+	resp, err = client.Get("/test")
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+}
+
+func TestNewHTTPClientHTTPErrorsRetryTimeout(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testClient{
+		resp: &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+		},
+	}
+	config := NewConfig()
+	config.HTTPErrors = true
+	config.Retryable = NewBackoffRetry(time.Millisecond, time.Millisecond*50, 200*time.Millisecond, 2)
+	client := NewHTTPClient(context.TODO(), config, tc)
+	resp, err := client.Get("/test")
+	assert.Nil(resp)
+	var httpErr *HTTPError
+	assert.True(errors.As(err, &httpErr))
+	assert.Equal(http.StatusServiceUnavailable, httpErr.StatusCode)
+}
+
+func TestNewHTTPClientRetryExhaustedError(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testClient{err: timeoutError{}}
+	config := NewConfig()
+	config.Retryable = NewBackoffRetry(time.Millisecond, time.Millisecond*50, 200*time.Millisecond, 2)
+	client := NewHTTPClient(context.TODO(), config, tc)
+	resp, err := client.Get("/test")
+	assert.Nil(resp)
+	assert.True(errors.Is(err, ErrRequestTimeout))
+	var exhausted *RetryExhaustedError
+	assert.True(errors.As(err, &exhausted))
+	assert.True(exhausted.Attempts > 1)
+	assert.Equal(timeoutError{}, exhausted.History[0].Err)
+	assert.Equal(0, exhausted.History[0].StatusCode)
+	assert.Equal(timeoutError{}, exhausted.Err)
+	// an HTTPClient wrapping this one doesn't retry the exhausted retries again
+	tc = &testClient{err: err}
+	client = NewHTTPClient(context.TODO(), config, tc)
+	_, err = client.Get("/test")
+	assert.Equal(tc.err, err)
+}
+
+func TestNewHTTPClientRequestContext(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testClient{}
+	clientCtx, clientCancel := context.WithCancel(context.WithValue(context.Background(), testContextKey("client"), "yes"))
+	defer clientCancel()
+	client := NewHTTPClient(clientCtx, NewConfig(), tc)
+	body := &testReader{}
+	tc.resp = &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       body,
+	}
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), testContextKey("trace"), "123"), time.Minute)
+	defer cancel()
+	resp, err := client.GetContext(ctx, "/test")
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	reqCtx := tc.req.Context()
+	assert.Equal("123", reqCtx.Value(testContextKey("trace")))
+	assert.Equal("yes", reqCtx.Value(testContextKey("client")))
+	_, ok := reqCtx.Deadline()
+	assert.True(ok)
+	assert.NoError(reqCtx.Err())
+	assert.NoError(resp.Body.Close())
+	assert.True(body.closed)
+	assert.Equal(context.Canceled, reqCtx.Err())
+}
+
+func TestNewHTTPClientPostContext(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testClient{}
+	client := NewHTTPClient(context.Background(), NewConfig(), tc)
+	tc.resp = &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       &testReader{},
+	}
+	ctx := context.WithValue(context.Background(), testContextKey("trace"), "123")
+	resp, err := client.PostContext(ctx, "/test", "application/json", strings.NewReader("{}"))
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(http.MethodPost, tc.req.Method)
+	assert.Equal("123", tc.req.Context().Value(testContextKey("trace")))
+}
+
+// testPostPagesClient returns the request body as the response with a page header until the last page
+type testPostPagesClient struct {
+	testClient
+	bodies []string
+}
+
+func (c *testPostPagesClient) Do(req *http.Request) (*http.Response, error) {
+	var buf []byte
+	if req.Body != nil {
+		buf, _ = ioutil.ReadAll(req.Body)
+	}
+	c.bodies = append(c.bodies, string(buf))
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewReader(buf)),
+	}
+	if len(c.bodies) < 3 {
+		resp.Header.Set("X-Next", fmt.Sprintf(`{"page":%d}`, len(c.bodies)+1))
+	}
+	return resp, nil
+}
+
+func TestNewHTTPClientPaginationPost(t *testing.T) {
+	assert := assert.New(t)
+	tc := &testPostPagesClient{}
+	p := &paginator{
+		paginate: func(page int, req *http.Request, resp *http.Response) (bool, *http.Request) {
+			if next := resp.Header.Get("X-Next"); next != "" {
+				return true, NewPageRequest(req, []byte(next))
+			}
+			return false, nil
+		},
+	}
+	config := NewConfig()
+	config.Paginator = PaginateMethods(p, http.MethodPost)
+	client := NewHTTPClient(context.TODO(), config, tc)
+	resp, err := client.Post("/test", "application/json", strings.NewReader(`{"page":1}`))
+	assert.NoError(err)
+	buf, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(err)
+	assert.Equal(`{"page":1}{"page":2}{"page":3}`, string(buf))
+	assert.Equal([]string{`{"page":1}`, `{"page":2}`, `{"page":3}`}, tc.bodies)
+	_, err = client.Get("/test")
+	assert.NoError(err)
+	assert.Len(tc.bodies, 4)
+}
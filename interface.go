@@ -1,6 +1,7 @@
 package httpclient
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"time"
@@ -21,7 +22,87 @@ type Retryable interface {
 	RetryMaxDuration() time.Duration
 }
 
+// ResponseRetryable is an optional interface a Retryable can implement to use the
+// last response when calculating the retry delay. The response is nil when the attempt
+// failed with an error and the body has already been consumed and closed.
+type ResponseRetryable interface {
+	RetryResponseDelay(retry int, resp *http.Response) time.Duration
+}
+
+// RequestRetryable is an optional interface a Retryable can implement to calculate the retry
+// delay from the previous delay of the same request, which is 0 on the first retry, along with
+// the last response. It's used instead of ResponseRetryable when both are implemented.
+type RequestRetryable interface {
+	RetryRequestDelay(retry int, prev time.Duration, resp *http.Response) time.Duration
+}
+
+// RandomSource is an interface for the source of random numbers used by the jittered
+// Retryable implementations which *rand.Rand implements
+type RandomSource interface {
+	Int63n(n int64) int64
+}
+
+// StatusPolicy is an interface for deciding if a response status code is terminal, in which
+// case the response is returned as-is, or if the response is handed to the Retryable
+type StatusPolicy interface {
+	Terminal(statusCode int) bool
+}
+
+// ResponseStatusPolicy is an optional interface a StatusPolicy can implement to decide if a
+// response is terminal from the whole response, such as its headers, rather than the status code
+type ResponseStatusPolicy interface {
+	TerminalResponse(resp *http.Response) bool
+}
+
 // Paginator is an interface for handling request pagination
 type Paginator interface {
 	HasMore(page int, req *http.Request, resp *http.Response) (bool, *http.Request)
 }
+
+// RangePaginator is an optional interface a Paginator can implement when a response tells the
+// total number of pages so that Do can fetch the remaining pages concurrently
+type RangePaginator interface {
+	// PageRequests returns the requests for all of the pages after this page, or nil if unknown
+	PageRequests(page int, req *http.Request, resp *http.Response) []*http.Request
+}
+
+// MethodPaginator is an optional interface a Paginator can implement to paginate requests with
+// methods other than GET (the default), such as a POST to a GraphQL or search API
+type MethodPaginator interface {
+	PaginateMethod(method string) bool
+}
+
+// CircuitBreaker is an interface for short-circuiting requests to an upstream which is failing
+type CircuitBreaker interface {
+	// Allow returns an error matching ErrCircuitOpen if the request must not be sent, otherwise
+	// the returned func must be called once with the outcome of the attempt
+	Allow(req *http.Request) (func(result CircuitResult), error)
+}
+
+// RateLimiter is an interface for throttling outgoing requests
+type RateLimiter interface {
+	// Wait blocks until the request can be sent or the context is done
+	Wait(ctx context.Context, req *http.Request) error
+}
+
+// ResponseObserver is an optional interface a RateLimiter can implement to see the response of
+// each attempt, including each page, such as to read the remaining quota from the headers
+type ResponseObserver interface {
+	Observe(req *http.Request, resp *http.Response)
+}
+
+// Bulkhead is an interface for limiting the number of requests in flight
+type Bulkhead interface {
+	// Acquire waits for a slot for the request, returning an error if none is free in time,
+	// otherwise the returned func must be called to release the slot
+	Acquire(ctx context.Context, req *http.Request) (func(), error)
+}
+
+// Hedger is an interface for deciding when to send a duplicate attempt of a slow request
+type Hedger interface {
+	// HedgeDelay returns how long to wait for a response before sending a duplicate attempt of
+	// the request, or false if the request must not be hedged
+	HedgeDelay(req *http.Request) (time.Duration, bool)
+	// Observe is told the latency of each successful attempt
+	Observe(req *http.Request, latency time.Duration)
+}
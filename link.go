@@ -0,0 +1,133 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Link is a single link from a Link header as described by RFC 8288
+type Link struct {
+	// Target is the target of the link as it appears in the header, which may be relative
+	Target string
+	// Rel is the set of relation types of the link, lower case
+	Rel []string
+	// Params are the other parameters of the link keyed by their lower case name
+	Params map[string]string
+}
+
+// HasRel returns true if the link has the relation type
+func (l Link) HasRel(rel string) bool {
+	for _, r := range l.Rel {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the target of the link resolved against the base url, usually the url of the request
+func (l Link) Resolve(base *url.URL) (*url.URL, error) {
+	target, err := url.Parse(l.Target)
+	if err != nil || base == nil {
+		return target, err
+	}
+	return base.ResolveReference(target), nil
+}
+
+// ParseLinkHeader parses all of the values of the Link header into the links they contain
+func ParseLinkHeader(header http.Header) []Link {
+	var links []Link
+	for _, value := range header[http.CanonicalHeaderKey("Link")] {
+		links = append(links, parseLinks(value)...)
+	}
+	return links
+}
+
+// parseLinks parses a single Link header value which may contain multiple comma separated links
+func parseLinks(s string) []Link {
+	var links []Link
+	for {
+		// skip anything up to the start of the next target
+		start := strings.IndexByte(s, '<')
+		if start < 0 {
+			return links
+		}
+		s = s[start+1:]
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return links
+		}
+		link := Link{
+			Target: strings.TrimSpace(s[:end]),
+			Params: make(map[string]string),
+		}
+		s = s[end+1:]
+		var rel *string
+		for {
+			s = strings.TrimLeft(s, " \t")
+			if len(s) == 0 || s[0] != ';' {
+				break
+			}
+			var name, value string
+			name, value, s = parseLinkParam(s[1:])
+			if name == "" {
+				continue
+			}
+			if name == "rel" {
+				// only the first rel parameter is used
+				if rel == nil {
+					rel = &value
+				}
+				continue
+			}
+			if _, exists := link.Params[name]; !exists {
+				link.Params[name] = value
+			}
+		}
+		if rel != nil {
+			for _, r := range strings.Fields(*rel) {
+				link.Rel = append(link.Rel, strings.ToLower(r))
+			}
+		}
+		links = append(links, link)
+	}
+}
+
+// parseLinkParam parses a single name[=value] parameter, returning the lower case name, the value
+// (unquoted if it was a quoted string) and the rest of the string
+func parseLinkParam(s string) (string, string, string) {
+	s = strings.TrimLeft(s, " \t")
+	i := strings.IndexAny(s, "=;,")
+	if i < 0 {
+		return strings.ToLower(strings.TrimSpace(s)), "", ""
+	}
+	name := strings.ToLower(strings.TrimSpace(s[:i]))
+	if s[i] != '=' {
+		return name, "", s[i:]
+	}
+	s = strings.TrimLeft(s[i+1:], " \t")
+	if len(s) > 0 && s[0] == '"' {
+		var value strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				if i+1 < len(s) {
+					i++
+					value.WriteByte(s[i])
+				}
+			case '"':
+				return name, value.String(), s[i+1:]
+			default:
+				value.WriteByte(s[i])
+			}
+		}
+		// unterminated quoted string
+		return name, value.String(), ""
+	}
+	end := strings.IndexAny(s, ";,")
+	if end < 0 {
+		return name, strings.TrimSpace(s), ""
+	}
+	return name, strings.TrimSpace(s[:end]), s[end:]
+}
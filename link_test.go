@@ -0,0 +1,50 @@
+package httpclient
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	assert := assert.New(t)
+	header := http.Header{}
+	header.Add("Link", `<https://foo.com/bar?page=2&a=1,2>; rel="next", <https://foo.com/bar?page=5>; rel=last; title="the \"end\"; really"`)
+	header.Add("Link", `</bar?page=1>; REL="Prev First"; type=text/html;hreflang=en`)
+	links := ParseLinkHeader(header)
+	assert.Len(links, 3)
+	assert.Equal("https://foo.com/bar?page=2&a=1,2", links[0].Target)
+	assert.Equal([]string{"next"}, links[0].Rel)
+	assert.Equal("https://foo.com/bar?page=5", links[1].Target)
+	assert.Equal([]string{"last"}, links[1].Rel)
+	assert.Equal(`the "end"; really`, links[1].Params["title"])
+	assert.Equal("/bar?page=1", links[2].Target)
+	assert.Equal([]string{"prev", "first"}, links[2].Rel)
+	assert.True(links[2].HasRel("first"))
+	assert.True(links[2].HasRel("PREV"))
+	assert.False(links[2].HasRel("next"))
+	assert.Equal("text/html", links[2].Params["type"])
+	assert.Equal("en", links[2].Params["hreflang"])
+	base, _ := url.Parse("https://foo.com/api/bar?page=2")
+	u, err := links[2].Resolve(base)
+	assert.NoError(err)
+	assert.Equal("https://foo.com/bar?page=1", u.String())
+	u, err = links[0].Resolve(nil)
+	assert.NoError(err)
+	assert.Equal("https://foo.com/bar?page=2&a=1,2", u.String())
+}
+
+func TestParseLinkHeaderMalformed(t *testing.T) {
+	assert := assert.New(t)
+	assert.Empty(ParseLinkHeader(http.Header{}))
+	assert.Empty(ParseLinkHeader(http.Header{"Link": []string{"garbage"}}))
+	assert.Empty(ParseLinkHeader(http.Header{"Link": []string{"<https://foo.com"}}))
+	links := ParseLinkHeader(http.Header{"Link": []string{`<a>; rel=next; rel=prev; anchor, <b>; title="unterminated`}})
+	assert.Len(links, 2)
+	assert.Equal([]string{"next"}, links[0].Rel)
+	assert.Equal("", links[0].Params["anchor"])
+	assert.Equal("b", links[1].Target)
+	assert.Equal("unterminated", links[1].Params["title"])
+}
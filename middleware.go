@@ -0,0 +1,62 @@
+package httpclient
+
+import (
+	"io"
+	"net/http"
+)
+
+// Middleware wraps a Client to add behavior around each request, such as setting auth
+// headers, logging or recording metrics
+type Middleware func(Client) Client
+
+// ClientFunc is an adapter to allow the use of a function as a Client
+type ClientFunc func(req *http.Request) (*http.Response, error)
+
+// ensure that we implement the Client interface
+var _ Client = (ClientFunc)(nil)
+
+// Do calls f(req)
+func (f ClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Get is a convenience method for making a Get request to a url
+func (f ClientFunc) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f(req)
+}
+
+// Post is a convenience method for making a Post request to a url
+func (f ClientFunc) Post(url string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return f(req)
+}
+
+// Chain returns a Client which invokes the middleware in order around the client, the first
+// middleware being the outermost
+func Chain(client Client, middleware ...Middleware) Client {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		client = middleware[i](client)
+	}
+	return client
+}
+
+// SetHeader returns a Middleware which sets the header on each request, replacing any existing
+// values. The request is copied so the header isn't set on the request of the caller.
+func SetHeader(key, value string) Middleware {
+	return func(next Client) Client {
+		return ClientFunc(func(req *http.Request) (*http.Response, error) {
+			newreq := req.WithContext(req.Context())
+			newreq.Header = cloneHeader(req.Header)
+			newreq.Header.Set(key, value)
+			return next.Do(newreq)
+		})
+	}
+}
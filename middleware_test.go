@@ -0,0 +1,55 @@
+package httpclient
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	assert := assert.New(t)
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next Client) Client {
+			return ClientFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name+">")
+				resp, err := next.Do(req)
+				calls = append(calls, "<"+name)
+				return resp, err
+			})
+		}
+	}
+	client := Chain(ClientFunc(func(req *http.Request) (*http.Response, error) {
+		calls = append(calls, "client")
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}), trace("a"), trace("b"))
+	resp, err := client.Get("https://foo.com")
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal([]string{"a>", "b>", "client", "<b", "<a"}, calls)
+}
+
+func TestMiddlewarePerAttempt(t *testing.T) {
+	assert := assert.New(t)
+	var headers []string
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		headers = append(headers, req.Header.Get("Authorization"))
+		if len(headers) < 3 {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	config := NewConfig()
+	config.Retryable = NewBackoffRetry(time.Millisecond, time.Millisecond, time.Second, 2)
+	config.Middleware = []Middleware{SetHeader("Authorization", "Bearer 123")}
+	client := NewHTTPClient(nil, config, tc)
+	req, _ := http.NewRequest(http.MethodPost, "https://foo.com", strings.NewReader("body"))
+	resp, err := client.Do(req)
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal([]string{"Bearer 123", "Bearer 123", "Bearer 123"}, headers)
+	assert.Empty(req.Header.Get("Authorization"))
+}
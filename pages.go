@@ -0,0 +1,431 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrPaginationLimit is an error that's returned when a pagination limit on the Config is reached
+var ErrPaginationLimit = errors.New("httpclient: pagination limit reached")
+
+// PaginationLimitError is returned when a pagination limit on the Config is reached before all of
+// the pages were fetched. It matches ErrPaginationLimit with errors.Is.
+type PaginationLimitError struct {
+	// Limit is the limit which was reached, one of pages, bytes or duration
+	Limit   string
+	Pages   int
+	Bytes   int64
+	Elapsed time.Duration
+	// Checkpoint can be used to fetch the rest of the pages
+	Checkpoint *Checkpoint
+}
+
+func (e *PaginationLimitError) Error() string {
+	return fmt.Sprintf("%v: max %s after %d pages (%d bytes) in %v", ErrPaginationLimit, e.Limit, e.Pages, e.Bytes, e.Elapsed)
+}
+
+// Is returns true if the target is ErrPaginationLimit
+func (e *PaginationLimitError) Is(target error) bool {
+	return target == ErrPaginationLimit
+}
+
+// Checkpoint is the serializable state of a paginated fetch which can be used to resume it
+// from the page it describes with DoFrom or PagesFrom
+type Checkpoint struct {
+	// Page is the number of the page
+	Page   int    `json:"page"`
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   []byte `json:"body,omitempty"`
+}
+
+// newCheckpoint returns a Checkpoint for the request of the page
+func newCheckpoint(page int, req *http.Request) *Checkpoint {
+	cp := &Checkpoint{
+		Page:   page,
+		Method: req.Method,
+	}
+	if req.URL != nil {
+		cp.URL = req.URL.String()
+	}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			cp.Body, _ = ioutil.ReadAll(body)
+			body.Close()
+		}
+	}
+	return cp
+}
+
+// Request returns the request for the page of the checkpoint, using req for the headers and context
+func (cp *Checkpoint) Request(req *http.Request) (*http.Request, error) {
+	u, err := url.Parse(cp.URL)
+	if err != nil {
+		return nil, err
+	}
+	newreq := NextPageRequest(req, u)
+	newreq.Method = cp.Method
+	if cp.Body != nil {
+		return NewPageRequest(newreq, cp.Body), nil
+	}
+	newreq.Body = nil
+	newreq.GetBody = nil
+	newreq.ContentLength = 0
+	return newreq, nil
+}
+
+// PaginationError is returned when fetching a page after the first page fails. It has the
+// Checkpoint of the failed page so the fetch can be resumed from it.
+type PaginationError struct {
+	Checkpoint *Checkpoint
+	Err        error
+}
+
+func (e *PaginationError) Error() string {
+	return fmt.Sprintf("httpclient: error fetching page %d: %v", e.Checkpoint.Page, e.Err)
+}
+
+// Unwrap returns the error of the failed page
+func (e *PaginationError) Unwrap() error {
+	return e.Err
+}
+
+// PageIterator iterates over the pages of a request, fetching each page lazily as Next is
+// called with the same retry semantics as Do. The body of each page is closed when the next
+// page is fetched so only one page is held at a time.
+//
+//	pages := client.Pages(req)
+//	defer pages.Close()
+//	for pages.Next() {
+//		resp := pages.Response()
+//		// process resp.Body
+//	}
+//	if err := pages.Err(); err != nil {
+//		// handle err
+//	}
+type PageIterator struct {
+	c          *HTTPClient
+	ctx        context.Context
+	cancel     context.CancelFunc
+	req        *http.Request
+	next       *http.Request
+	ranged     []*http.Request
+	resp       *http.Response
+	page       int
+	fetched    int
+	started    time.Time
+	truncated  bool
+	limit      string
+	checkpoint *Checkpoint
+	err        error
+}
+
+// Pages returns a PageIterator for the request. The request is cancelled when either the
+// context of the request or the context of the HTTPClient is done.
+func (c *HTTPClient) Pages(req *http.Request) *PageIterator {
+	return c.PagesContext(req.Context(), req)
+}
+
+// PagesContext returns a PageIterator for the request with the context, which replaces the context of the request
+func (c *HTTPClient) PagesContext(ctx context.Context, req *http.Request) *PageIterator {
+	ctx, cancel := mergeContext(ctx, c.ctx)
+	it := c.pages(req.WithContext(ctx))
+	it.cancel = cancel
+	return it
+}
+
+// PagesFrom returns a PageIterator which resumes from the Checkpoint, using req for the headers and context
+func (c *HTTPClient) PagesFrom(req *http.Request, cp *Checkpoint) (*PageIterator, error) {
+	req, err := cp.Request(req)
+	if err != nil {
+		return nil, err
+	}
+	it := c.Pages(req)
+	it.page = cp.Page - 1
+	return it, nil
+}
+
+func (c *HTTPClient) pages(req *http.Request) *PageIterator {
+	return &PageIterator{
+		c:    c,
+		ctx:  req.Context(),
+		next: req,
+	}
+}
+
+// Next fetches the next page, returning false when there are no more pages or an error occurred
+func (it *PageIterator) Next() bool {
+	it.closeResponse()
+	if it.next == nil || it.err != nil {
+		it.stop()
+		return false
+	}
+	first := it.started.IsZero()
+	if first {
+		it.started = time.Now()
+	} else if limit := it.limitReached(); limit != "" {
+		it.checkpoint = newCheckpoint(it.page+1, it.next)
+		it.next = nil
+		if it.c.config.TruncatePagination {
+			it.truncated = true
+			it.limit = limit
+		} else {
+			it.err = it.limitError(limit, 0)
+		}
+		it.stop()
+		return false
+	}
+	req := it.next
+	it.req = req
+	it.page++
+	resp, err := it.c.send(req, it.page)
+	if err != nil {
+		it.next = nil
+		it.checkpoint = newCheckpoint(it.page, req)
+		it.err = err
+		if it.page > 1 {
+			it.err = &PaginationError{it.checkpoint, err}
+		}
+		it.stop()
+		return false
+	}
+	it.fetched++
+	it.next = nil
+	if first && it.c.config.PrefetchConcurrency > 1 && resp.StatusCode == http.StatusOK && it.c.paginatesMethod(req.Method) {
+		// check for the total number of pages before HasMore possibly changes the response
+		if rp, ok := it.c.config.Paginator.(RangePaginator); ok {
+			it.ranged = rp.PageRequests(it.page, req, resp)
+		}
+	}
+	if ok, newreq := it.c.paginate(it.page, req, resp); ok {
+		// don't reuse this request again
+		req.Close = true
+		// keep our context for the next page
+		it.next = newreq.WithContext(it.ctx)
+	}
+	it.resp = resp
+	return true
+}
+
+// Response returns the response of the current page
+func (it *PageIterator) Response() *http.Response {
+	return it.resp
+}
+
+// Page returns the number of the current page, starting at 1
+func (it *PageIterator) Page() int {
+	return it.page
+}
+
+// Truncated returns true if the iteration stopped at a pagination limit on the Config
+// with TruncatePagination set, leaving pages which weren't fetched
+func (it *PageIterator) Truncated() bool {
+	return it.truncated
+}
+
+// Checkpoint returns the Checkpoint of the page which wasn't fetched when the iteration
+// stopped with an error or at a pagination limit, otherwise nil
+func (it *PageIterator) Checkpoint() *Checkpoint {
+	return it.checkpoint
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *PageIterator) Err() error {
+	return it.err
+}
+
+// Close closes the body of the current page and stops the iteration
+func (it *PageIterator) Close() error {
+	it.closeResponse()
+	it.next = nil
+	it.stop()
+	return nil
+}
+
+// limitReached returns the name of the pagination limit reached before fetching the next page, if any
+func (it *PageIterator) limitReached() string {
+	config := it.c.config
+	if config.MaxPages > 0 && it.fetched >= config.MaxPages {
+		return "pages"
+	}
+	if config.MaxPaginationDuration > 0 && time.Since(it.started) >= config.MaxPaginationDuration {
+		return "duration"
+	}
+	return ""
+}
+
+func (it *PageIterator) limitError(limit string, bytes int64) error {
+	return &PaginationLimitError{
+		Limit:      limit,
+		Pages:      it.fetched,
+		Bytes:      bytes,
+		Elapsed:    time.Since(it.started),
+		Checkpoint: it.checkpoint,
+	}
+}
+
+func (it *PageIterator) closeResponse() {
+	if it.resp != nil && it.resp.Body != nil {
+		it.resp.Body.Close()
+	}
+	it.resp = nil
+}
+
+func (it *PageIterator) stop() {
+	if it.cancel != nil {
+		it.cancel()
+		it.cancel = nil
+	}
+}
+
+// contextError returns the error of the context if it's done instead of err
+func (it *PageIterator) contextError(err error) error {
+	if ctxErr := it.ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("httpclient: %s %v cancelled on page %d: %w", it.req.Method, it.req.URL, it.page, ctxErr)
+	}
+	return err
+}
+
+// errPrefetchDuration is returned by prefetch when Config.MaxPaginationDuration is reached
+var errPrefetchDuration = errors.New("httpclient: pagination duration limit")
+
+// prefetch fetches the pages concurrently with Config.PrefetchConcurrency workers and returns the
+// responses in page order with their bodies, which are also left in memory as the response bodies.
+// It stops after a page which isn't a 200, as sequential pagination would, and after the page which
+// takes the pages in order over budget bytes, unless budget is negative. At the first failed page it
+// returns the pages before it and a *PaginationError with the Checkpoint and the error of the failed
+// page. The pages after a stopped page are cancelled while the pages before it are left to finish.
+// It returns errPrefetchDuration with the pages before the first one not started in time when
+// Config.MaxPaginationDuration is reached.
+func (c *HTTPClient) prefetch(ctx context.Context, reqs []*http.Request, firstPage int, started time.Time, budget int64) ([]*http.Response, [][]byte, error) {
+	resps := make([]*http.Response, len(reqs))
+	bodies := make([][]byte, len(reqs))
+	errs := make([]error, len(reqs))
+	cancels := make([]context.CancelFunc, len(reqs))
+	var mu sync.Mutex
+	// the index of the first page which stopped the pagination, there's no need to fetch the pages after it
+	stopped := len(reqs)
+	// the bytes of the pages in order which have been fetched and the index of the next page to count
+	var used int64
+	var counted int
+	stopLocked := func(i int) {
+		if i < stopped {
+			stopped = i
+			for _, cancel := range cancels[i+1:] {
+				if cancel != nil {
+					cancel()
+				}
+			}
+		}
+	}
+	stop := func(i int) {
+		mu.Lock()
+		defer mu.Unlock()
+		stopLocked(i)
+	}
+	// finish counts the bytes of the pages in order up to the pages which are still being fetched
+	finish := func(i int, resp *http.Response, body []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		resps[i] = resp
+		bodies[i] = body
+		for ; counted < len(reqs) && resps[counted] != nil; counted++ {
+			used += int64(len(bodies[counted]))
+			if budget >= 0 && used > budget {
+				stopLocked(counted)
+			}
+		}
+		if resp.StatusCode != http.StatusOK {
+			stopLocked(i)
+		}
+	}
+	// start returns the context for fetching the page or false if it's after a stopped page
+	start := func(i int) (context.Context, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if i > stopped {
+			return nil, false
+		}
+		pageCtx, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+		return pageCtx, true
+	}
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range reqs {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	workers := c.config.PrefetchConcurrency
+	if workers > len(reqs) {
+		workers = len(reqs)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if limit := c.config.MaxPaginationDuration; limit > 0 && time.Since(started) >= limit {
+					errs[i] = errPrefetchDuration
+					stop(i)
+					continue
+				}
+				pageCtx, ok := start(i)
+				if !ok {
+					continue
+				}
+				req := reqs[i].WithContext(pageCtx)
+				resp, err := c.send(req, firstPage+i)
+				var body []byte
+				if err == nil {
+					// let the paginator see the page as it would sequentially, for example to rewrite the body
+					c.paginate(firstPage+i, req, resp)
+					// read the body now to free up the connection
+					body, err = readBody(resp)
+				}
+				cancels[i]()
+				if err != nil {
+					errs[i] = err
+					stop(i)
+					continue
+				}
+				finish(i, resp, body)
+			}
+		}()
+	}
+	wg.Wait()
+	n := len(reqs)
+	if stopped < n {
+		n = stopped + 1
+	}
+	for i := 0; i < n; i++ {
+		if errs[i] == errPrefetchDuration {
+			return resps[:i], bodies[:i], errPrefetchDuration
+		}
+		if resps[i] == nil {
+			err := errs[i]
+			if err == nil {
+				// never started since the context is done
+				err = ctx.Err()
+			}
+			// resume from the first page we don't have
+			return resps[:i], bodies[:i], &PaginationError{newCheckpoint(firstPage+i, reqs[i]), err}
+		}
+		if resps[i].StatusCode != http.StatusOK {
+			return resps[:i+1], bodies[:i+1], nil
+		}
+	}
+	return resps[:n], bodies[:n], nil
+}
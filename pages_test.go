@@ -0,0 +1,459 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPagesClient returns a response for each page with a link to the next page
+type testPagesClient struct {
+	testClient
+	pages    int
+	requests []*http.Request
+	bodies   []*testReader
+	fail     map[int]int
+}
+
+func (c *testPagesClient) Do(req *http.Request) (*http.Response, error) {
+	c.requests = append(c.requests, req)
+	page := 1
+	if p := req.URL.Query().Get("page"); p != "" {
+		fmt.Sscanf(p, "%d", &page)
+	}
+	if c.fail[page] > 0 {
+		c.fail[page]--
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: &testReader{}, Request: req}, nil
+	}
+	body := &testReader{buf: *bytes.NewBufferString(fmt.Sprintf("[%d]", page))}
+	c.bodies = append(c.bodies, body)
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       body,
+		Request:    req,
+	}
+	if page < c.pages {
+		resp.Header.Set("Link", fmt.Sprintf(`<https://foo.com/bar?page=%d>; rel="next"`, page+1))
+	}
+	return resp, nil
+}
+
+func newTestPagesClient(pages int) (*testPagesClient, *HTTPClient) {
+	tc := &testPagesClient{pages: pages, fail: make(map[int]int)}
+	config := NewConfig()
+	config.Paginator = NewLinkPaginator()
+	config.Retryable = NewBackoffRetry(time.Millisecond, time.Millisecond, time.Second, 2)
+	return tc, NewHTTPClient(context.Background(), config, tc)
+}
+
+func TestPages(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestPagesClient(3)
+	tc.fail[2] = 1
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	pages := client.Pages(req)
+	defer pages.Close()
+	var bodies []string
+	for pages.Next() {
+		// only the current page has been fetched
+		assert.Len(tc.bodies, pages.Page())
+		buf, err := ioutil.ReadAll(pages.Response().Body)
+		assert.NoError(err)
+		bodies = append(bodies, string(buf))
+	}
+	assert.NoError(pages.Err())
+	assert.Equal([]string{"[1]", "[2]", "[3]"}, bodies)
+	assert.Len(tc.requests, 4)
+	for _, body := range tc.bodies {
+		assert.True(body.closed)
+	}
+	assert.False(pages.Next())
+}
+
+func TestPagesError(t *testing.T) {
+	assert := assert.New(t)
+	_, client := newTestPagesClient(3)
+	client.c = &testClient{err: errors.New("error")}
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	pages := client.Pages(req)
+	assert.False(pages.Next())
+	assert.EqualError(pages.Err(), "error")
+	assert.Nil(pages.Response())
+}
+
+func TestPagesClose(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestPagesClient(3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	pages := client.PagesContext(ctx, req)
+	assert.True(pages.Next())
+	assert.Equal(1, pages.Page())
+	assert.NoError(pages.Close())
+	assert.True(tc.bodies[0].closed)
+	assert.False(pages.Next())
+	assert.Len(tc.requests, 1)
+}
+
+func TestDoPages(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestPagesClient(3)
+	u, _ := url.Parse("https://foo.com/bar")
+	resp, err := client.Do(&http.Request{Method: http.MethodGet, URL: u, Header: http.Header{}})
+	assert.NoError(err)
+	buf, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(err)
+	assert.Equal("[1][2][3]", string(buf))
+	assert.Len(tc.requests, 3)
+}
+
+func TestPagesMaxPages(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestPagesClient(100)
+	client.config.MaxPages = 2
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	pages := client.Pages(req)
+	assert.True(pages.Next())
+	assert.True(pages.Next())
+	assert.False(pages.Next())
+	assert.True(errors.Is(pages.Err(), ErrPaginationLimit))
+	assert.False(pages.Truncated())
+	assert.Len(tc.requests, 2)
+	resp, err := client.Do(req)
+	assert.Nil(resp)
+	var limitErr *PaginationLimitError
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal("pages", limitErr.Limit)
+	assert.Equal(2, limitErr.Pages)
+	assert.Equal(int64(6), limitErr.Bytes)
+	client.config.TruncatePagination = true
+	resp, err = client.Do(req)
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal("pages", limitErr.Limit)
+	assert.Equal(3, limitErr.Checkpoint.Page)
+	buf, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal("[1][2]", string(buf))
+	pages = client.Pages(req)
+	for pages.Next() {
+	}
+	assert.NoError(pages.Err())
+	assert.True(pages.Truncated())
+}
+
+func TestPagesMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	_, client := newTestPagesClient(100)
+	client.config.MaxPaginationBytes = 7
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	resp, err := client.Do(req)
+	assert.Nil(resp)
+	var limitErr *PaginationLimitError
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal("bytes", limitErr.Limit)
+	assert.Equal(3, limitErr.Pages)
+	assert.Equal(int64(6), limitErr.Bytes)
+	client.config.TruncatePagination = true
+	resp, err = client.Do(req)
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal("bytes", limitErr.Limit)
+	assert.Equal(3, limitErr.Checkpoint.Page)
+	buf, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal("[1][2]", string(buf))
+	// the first page alone is over the limit
+	client.config.MaxPaginationBytes = 2
+	resp, err = client.Do(req)
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal("bytes", limitErr.Limit)
+	assert.Equal(1, limitErr.Checkpoint.Page)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	buf, _ = ioutil.ReadAll(resp.Body)
+	assert.Empty(buf)
+}
+
+func TestPagesMaxDuration(t *testing.T) {
+	assert := assert.New(t)
+	_, client := newTestPagesClient(100)
+	client.config.MaxPaginationDuration = time.Nanosecond
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	resp, err := client.Do(req)
+	assert.Nil(resp)
+	var limitErr *PaginationLimitError
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal("duration", limitErr.Limit)
+	assert.Equal(1, limitErr.Pages)
+	assert.Contains(err.Error(), "httpclient: pagination limit reached: max duration after 1 pages (3 bytes)")
+}
+
+// testRangeClient returns pages of a page number paginated API with a total header, tracking concurrency
+type testRangeClient struct {
+	testClient
+	mu       sync.Mutex
+	total    int
+	inflight int
+	max      int
+	requests int
+	fail     int
+}
+
+func (c *testRangeClient) Do(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests++
+	c.inflight++
+	if c.inflight > c.max {
+		c.max = c.inflight
+	}
+	c.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	c.mu.Lock()
+	c.inflight--
+	c.mu.Unlock()
+	page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+	if page == 0 {
+		page = 1
+	}
+	if page == c.fail {
+		return nil, errors.New("failed")
+	}
+	var items []string
+	for i := (page-1)*2 + 1; i <= page*2 && i <= c.total; i++ {
+		items = append(items, strconv.Itoa(i))
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"X-Total-Count": []string{strconv.Itoa(c.total)}},
+		Body:       ioutil.NopCloser(strings.NewReader("[" + strings.Join(items, ",") + "]")),
+	}, nil
+}
+
+func newTestRangeClient(total int) (*testRangeClient, *HTTPClient) {
+	tc := &testRangeClient{total: total}
+	config := NewConfig()
+	config.Paginator = NewPagePaginator(PagePaginatorConfig{PerPage: 2, TotalHeader: "X-Total-Count"})
+	config.PrefetchConcurrency = 3
+	return tc, NewHTTPClient(context.Background(), config, tc)
+}
+
+func TestDoPrefetch(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestRangeClient(19)
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	resp, err := client.Do(req)
+	assert.NoError(err)
+	buf, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal("[1,2][3,4][5,6][7,8][9,10][11,12][13,14][15,16][17,18][19]", string(buf))
+	assert.Equal(10, tc.requests)
+	assert.True(tc.max > 1)
+	assert.True(tc.max <= 3)
+}
+
+func TestDoPrefetchMaxPages(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestRangeClient(19)
+	client.config.MaxPages = 4
+	client.config.TruncatePagination = true
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	resp, err := client.Do(req)
+	var limitErr *PaginationLimitError
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal("pages", limitErr.Limit)
+	assert.Equal(5, limitErr.Checkpoint.Page)
+	buf, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal("[1,2][3,4][5,6][7,8]", string(buf))
+	assert.Equal(4, tc.requests)
+}
+
+func TestDoPrefetchMaxPagesError(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestRangeClient(19)
+	client.config.MaxPages = 4
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	resp, err := client.Do(req)
+	assert.Nil(resp)
+	var limitErr *PaginationLimitError
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal("pages", limitErr.Limit)
+	assert.Equal(4, limitErr.Pages)
+	assert.Equal(5, limitErr.Checkpoint.Page)
+	assert.Equal("https://foo.com/bar?page=5&per_page=2", limitErr.Checkpoint.URL)
+	assert.Equal(4, tc.requests)
+	// the first page uses up the limit
+	tc, client = newTestRangeClient(19)
+	client.config.MaxPages = 1
+	resp, err = client.Do(req)
+	assert.Nil(resp)
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal(1, limitErr.Pages)
+	assert.Equal(2, limitErr.Checkpoint.Page)
+	assert.Equal(1, tc.requests)
+	client.config.TruncatePagination = true
+	resp, err = client.Do(req)
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal(2, limitErr.Checkpoint.Page)
+	buf, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal("[1,2]", string(buf))
+	assert.Equal(2, tc.requests)
+}
+
+func TestDoPrefetchMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestRangeClient(39)
+	client.config.MaxPaginationBytes = 12
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	resp, err := client.Do(req)
+	assert.Nil(resp)
+	var limitErr *PaginationLimitError
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal("bytes", limitErr.Limit)
+	assert.Equal(int64(10), limitErr.Bytes)
+	assert.Equal(3, limitErr.Checkpoint.Page)
+	// the pages after the budget was used up aren't fetched
+	assert.True(tc.requests < 10)
+}
+
+func TestDoPrefetchMaxDuration(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestRangeClient(19)
+	client.config.MaxPaginationDuration = 8 * time.Millisecond
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	resp, err := client.Do(req)
+	assert.Nil(resp)
+	var limitErr *PaginationLimitError
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal("duration", limitErr.Limit)
+	assert.True(limitErr.Checkpoint.Page > 1 && limitErr.Checkpoint.Page < 10)
+	assert.Equal(limitErr.Checkpoint.Page-1, limitErr.Pages)
+	assert.True(tc.requests < 10)
+}
+
+func TestDoPrefetchError(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestRangeClient(19)
+	tc.fail = 5
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	resp, err := client.Do(req)
+	assert.Nil(resp)
+	var pageErr *PaginationError
+	assert.True(errors.As(err, &pageErr))
+	// the pages before the failed page are fetched rather than cancelled
+	assert.EqualError(pageErr.Err, "failed")
+	assert.Equal(5, pageErr.Checkpoint.Page)
+	tc.fail = 0
+	client.config.PrefetchConcurrency = 0
+	resp, err = client.DoFrom(req, pageErr.Checkpoint)
+	assert.NoError(err)
+	buf, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal("[9,10][11,12][13,14][15,16][17,18][19]", string(buf))
+}
+
+func TestInBodyPaginatorPageRequests(t *testing.T) {
+	assert := assert.New(t)
+	p := InBodyPaginator().(RangePaginator)
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar?p=1", nil)
+	resp := &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{"paging":{"pageIndex":1,"pageSize":2,"total":5}}`))}
+	reqs := p.PageRequests(1, req, resp)
+	assert.Len(reqs, 2)
+	assert.Equal("https://foo.com/bar?p=2", reqs[0].URL.String())
+	assert.Equal("https://foo.com/bar?p=3", reqs[1].URL.String())
+	buf, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(`{"paging":{"pageIndex":1,"pageSize":2,"total":5}}`, string(buf))
+	assert.Nil(p.PageRequests(1, req, &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{}`))}))
+}
+
+func TestPagesCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	tc, client := newTestPagesClient(4)
+	client.c = &testPagesClient{pages: 4, fail: map[int]int{3: 1000}}
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	pages := client.Pages(req)
+	assert.True(pages.Next())
+	assert.True(pages.Next())
+	assert.Nil(pages.Checkpoint())
+	assert.False(pages.Next())
+	var pageErr *PaginationError
+	assert.True(errors.As(pages.Err(), &pageErr))
+	var exhausted *RetryExhaustedError
+	assert.True(errors.As(pages.Err(), &exhausted))
+	cp := pages.Checkpoint()
+	assert.Equal(pageErr.Checkpoint, cp)
+	assert.Equal(&Checkpoint{Page: 3, Method: http.MethodGet, URL: "https://foo.com/bar?page=3"}, cp)
+	// the checkpoint can be saved and loaded
+	buf, err := json.Marshal(cp)
+	assert.NoError(err)
+	var loaded Checkpoint
+	assert.NoError(json.Unmarshal(buf, &loaded))
+	client.c = tc
+	pages, err = client.PagesFrom(req, &loaded)
+	assert.NoError(err)
+	var bodies []string
+	for pages.Next() {
+		buf, _ := ioutil.ReadAll(pages.Response().Body)
+		bodies = append(bodies, fmt.Sprintf("%d:%s", pages.Page(), buf))
+	}
+	assert.NoError(pages.Err())
+	assert.Equal([]string{"3:[3]", "4:[4]"}, bodies)
+	assert.Equal("Bearer 123", tc.requests[0].Header.Get("Authorization"))
+	assert.Equal("https://foo.com/bar?page=3", tc.requests[0].URL.String())
+}
+
+func TestPagesCheckpointLimit(t *testing.T) {
+	assert := assert.New(t)
+	_, client := newTestPagesClient(5)
+	client.config.MaxPages = 2
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	resp, err := client.Do(req)
+	assert.Nil(resp)
+	var limitErr *PaginationLimitError
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal(3, limitErr.Checkpoint.Page)
+	resp, err = client.DoFrom(req, limitErr.Checkpoint)
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal(5, limitErr.Checkpoint.Page)
+	client.config.MaxPages = 0
+	client.config.MaxPaginationBytes = 5
+	resp, err = client.DoFrom(req, limitErr.Checkpoint)
+	assert.NoError(err)
+	buf, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal("[5]", string(buf))
+	resp, err = client.Do(req)
+	assert.True(errors.As(err, &limitErr))
+	assert.Equal("bytes", limitErr.Limit)
+	assert.Equal(2, limitErr.Checkpoint.Page)
+}
+
+func TestCheckpointRequest(t *testing.T) {
+	assert := assert.New(t)
+	req, _ := http.NewRequest(http.MethodPost, "https://foo.com/graphql", strings.NewReader(`{"after":""}`))
+	req.Header.Set("Authorization", "Bearer 123")
+	next := NewPageRequest(req, []byte(`{"after":"abc"}`))
+	cp := newCheckpoint(2, next)
+	assert.Equal(`{"after":"abc"}`, string(cp.Body))
+	r, err := cp.Request(req)
+	assert.NoError(err)
+	assert.Equal(http.MethodPost, r.Method)
+	assert.Equal("Bearer 123", r.Header.Get("Authorization"))
+	buf, _ := ioutil.ReadAll(r.Body)
+	assert.Equal(`{"after":"abc"}`, string(buf))
+	cp = &Checkpoint{Page: 2, Method: http.MethodGet, URL: "https://other.com/bar?page=2"}
+	r, err = cp.Request(req)
+	assert.NoError(err)
+	assert.Equal(http.MethodGet, r.Method)
+	assert.Nil(r.Body)
+	assert.Empty(r.Header.Get("Authorization"))
+	_, err = (&Checkpoint{URL: "http://[::1"}).Request(req)
+	assert.Error(err)
+}
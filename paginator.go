@@ -3,11 +3,14 @@ package httpclient
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"net/http"
-	"regexp"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
@@ -26,26 +29,109 @@ func NoPaginator() Paginator {
 	return &noPaginator{}
 }
 
+type methodPaginator struct {
+	Paginator
+	methods map[string]bool
+}
+
+var _ MethodPaginator = (*methodPaginator)(nil)
+
+func (p *methodPaginator) PaginateMethod(method string) bool {
+	return p.methods[method]
+}
+
+// PaginateMethods returns a Paginator which paginates requests with the methods passed in using paginator
+func PaginateMethods(paginator Paginator, methods ...string) Paginator {
+	p := &methodPaginator{paginator, make(map[string]bool)}
+	for _, method := range methods {
+		p.methods[method] = true
+	}
+	return p
+}
+
+// NewPageRequest returns a copy of the request for the next page which sends body instead of the
+// body of the request. It can be used by a Paginator for APIs which paginate with the request body,
+// such as a cursor in a GraphQL query.
+func NewPageRequest(req *http.Request, body []byte) *http.Request {
+	newreq := NextPageRequest(req, nil)
+	newreq.ContentLength = int64(len(body))
+	newreq.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	newreq.Body, _ = newreq.GetBody()
+	return newreq
+}
+
+// credentialHeaders are the headers removed from the next page request when it's for a different host
+var credentialHeaders = []string{"Authorization", "Cookie", "Cookie2"}
+
+// NextPageRequest returns a copy of the request for the next page at the url, or the same url if nil,
+// which should be used by a Paginator to build the next request. The copy has its own headers, keeps
+// the context, cookies, credentials and Host override of the request and has its body rewound if
+// possible, otherwise it has no body since the body was read by the request. If the url is for a
+// different host the credentials, cookies and Host override are removed.
+func NextPageRequest(req *http.Request, next *url.URL) *http.Request {
+	newreq := req.WithContext(req.Context())
+	newreq.Close = false
+	newreq.Header = cloneHeader(req.Header)
+	if next == nil && req.URL != nil {
+		u := *req.URL
+		next = &u
+	}
+	newreq.URL = next
+	if req.URL != nil && next != nil && !strings.EqualFold(req.URL.Host, next.Host) {
+		for _, h := range credentialHeaders {
+			newreq.Header.Del(h)
+		}
+		newreq.Host = ""
+	}
+	var body io.ReadCloser
+	if req.GetBody != nil {
+		body, _ = req.GetBody()
+	}
+	if body != nil {
+		newreq.Body = body
+	} else if req.Body != nil && req.Body != http.NoBody {
+		newreq.Body = nil
+		newreq.ContentLength = 0
+	}
+	return newreq
+}
+
+// cloneHeader returns a deep copy of the header
+func cloneHeader(header http.Header) http.Header {
+	newheader := make(http.Header, len(header))
+	for k, v := range header {
+		newheader[k] = append([]string(nil), v...)
+	}
+	return newheader
+}
+
+// readBody reads the response body and replaces it so that it can be read again
+func readBody(resp *http.Response) ([]byte, error) {
+	if resp.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
 type linkPaginator struct {
 }
 
 // make sure it implements the interface
 var _ Paginator = (*linkPaginator)(nil)
 
-var re = regexp.MustCompile("<(.*)>")
-
 func (linkPaginator) HasMore(page int, req *http.Request, resp *http.Response) (bool, *http.Request) {
-	link := resp.Header.Get("link")
-	if link != "" {
-		for _, token := range strings.Split(link, ", ") {
-			if strings.Contains(token, "rel=\"next\"") {
-				url := re.FindStringSubmatch(token)
-				if len(url) > 1 {
-					newreq, _ := http.NewRequest(req.Method, url[1], nil)
-					newreq.Header = req.Header
-					return true, newreq
-				}
+	for _, link := range ParseLinkHeader(resp.Header) {
+		if link.HasRel("next") {
+			u, err := link.Resolve(req.URL)
+			if err != nil {
+				return false, nil
 			}
+			return true, NextPageRequest(req, u)
 		}
 	}
 	return false, nil
@@ -61,9 +147,35 @@ type inBodyPaginator struct {
 
 // make sure it implements the interface
 var _ Paginator = (*inBodyPaginator)(nil)
+var _ RangePaginator = (*inBodyPaginator)(nil)
+
+func (inBodyPaginator) PageRequests(page int, req *http.Request, resp *http.Response) []*http.Request {
+	body, err := readBody(resp)
+	if err != nil {
+		return nil
+	}
+	var B struct {
+		Paging *struct {
+			PageIndex int     `json:"pageIndex"`
+			PageSize  float64 `json:"pageSize"`
+			Total     float64 `json:"total"`
+		} `json:"paging"`
+	}
+	if err := json.Unmarshal(body, &B); err != nil || B.Paging == nil || B.Paging.PageSize <= 0 || B.Paging.Total <= 0 {
+		return nil
+	}
+	var reqs []*http.Request
+	totalPages := int(math.Ceil(B.Paging.Total / B.Paging.PageSize))
+	for i := B.Paging.PageIndex + 1; i <= totalPages; i++ {
+		newURL := *req.URL
+		setQueryParam(&newURL, "p", strconv.Itoa(i))
+		reqs = append(reqs, NextPageRequest(req, &newURL))
+	}
+	return reqs
+}
 
 func (inBodyPaginator) HasMore(page int, req *http.Request, resp *http.Response) (bool, *http.Request) {
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := readBody(resp)
 	if err != nil {
 		return false, nil
 	}
@@ -91,17 +203,10 @@ func (inBodyPaginator) HasMore(page int, req *http.Request, resp *http.Response)
 		}
 
 		if totalPages := int(math.Ceil(P.Total / P.PageSize)); P.PageIndex < totalPages {
-			index := fmt.Sprintf("p=%v", P.PageIndex)
-			newIndex := fmt.Sprintf("p=%v", (P.PageIndex + 1))
-			newURL := strings.Replace(req.URL.String(), index, newIndex, 1)
-			newreq, _ := http.NewRequest(req.Method, newURL, nil)
-			if user, pass, ok := req.BasicAuth(); ok {
-				newreq.SetBasicAuth(user, pass)
-			}
-			return true, newreq
+			newURL := *req.URL
+			setQueryParam(&newURL, "p", strconv.Itoa(P.PageIndex+1))
+			return true, NextPageRequest(req, &newURL)
 		}
-	} else {
-		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
 	}
 	return false, nil
 }
@@ -110,3 +215,341 @@ func (inBodyPaginator) HasMore(page int, req *http.Request, resp *http.Response)
 func InBodyPaginator() Paginator {
 	return &inBodyPaginator{}
 }
+
+// CursorPaginatorConfig is the configuration for a Paginator which uses a cursor in the response body
+type CursorPaginatorConfig struct {
+	// CursorPath is the dot separated path of the cursor for the next page in the response body, such
+	// as meta.next_cursor or data.search.pageInfo.endCursor. Pagination stops when the cursor is empty.
+	CursorPath string
+	// HasNextPath is the optional dot separated path of a boolean in the response body which is false
+	// on the last page, such as data.search.pageInfo.hasNextPage
+	HasNextPath string
+	// QueryParam is the query parameter which is set to the cursor for the next page
+	QueryParam string
+	// BodyField is the dot separated path of the field in the JSON request body which is set to the
+	// cursor for the next page, such as variables.after. Requests with any method are paginated when set.
+	BodyField string
+}
+
+type cursorPaginator struct {
+	config CursorPaginatorConfig
+}
+
+// make sure it implements the interface
+var _ Paginator = (*cursorPaginator)(nil)
+var _ MethodPaginator = (*cursorPaginator)(nil)
+
+func (p *cursorPaginator) PaginateMethod(method string) bool {
+	return method == http.MethodGet || p.config.BodyField != ""
+}
+
+func (p *cursorPaginator) HasMore(page int, req *http.Request, resp *http.Response) (bool, *http.Request) {
+	body, err := readBody(resp)
+	if err != nil {
+		return false, nil
+	}
+	if p.config.HasNextPath != "" {
+		if v, ok := jsonPath(body, p.config.HasNextPath); ok {
+			var hasNext bool
+			if err := json.Unmarshal(v, &hasNext); err == nil && !hasNext {
+				return false, nil
+			}
+		}
+	}
+	raw, ok := jsonPath(body, p.config.CursorPath)
+	if !ok {
+		return false, nil
+	}
+	var cursor string
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		// a cursor which isn't a string, such as a number, is used as-is
+		cursor = string(raw)
+	}
+	if cursor == "" {
+		return false, nil
+	}
+	var newreq *http.Request
+	if p.config.QueryParam != "" {
+		if req.URL.Query().Get(p.config.QueryParam) == cursor {
+			// the same cursor would just fetch the same page again
+			return false, nil
+		}
+		newreq = NextPageRequest(req, nil)
+		setQueryParam(newreq.URL, p.config.QueryParam, cursor)
+	}
+	if p.config.BodyField != "" {
+		if newreq == nil {
+			newreq = req
+		}
+		newbody, err := setBodyField(newreq, p.config.BodyField, raw)
+		if err != nil {
+			return false, nil
+		}
+		newreq = NewPageRequest(newreq, newbody)
+	}
+	return newreq != nil, newreq
+}
+
+// NewCursorPaginator returns a new Paginator which reads the cursor for the next page from the
+// response body and sets it as a query parameter and/or a field of the JSON request body
+func NewCursorPaginator(config CursorPaginatorConfig) Paginator {
+	return &cursorPaginator{config}
+}
+
+// setQueryParam sets the query parameter of the url to value, replacing any existing values
+func setQueryParam(u *url.URL, name string, value string) {
+	q := u.Query()
+	q.Set(name, value)
+	u.RawQuery = q.Encode()
+}
+
+// setBodyField returns the JSON body of the request with the field at the dot separated path set to value
+func setBodyField(req *http.Request, path string, value json.RawMessage) ([]byte, error) {
+	obj := make(map[string]interface{})
+	if req.GetBody == nil && req.Body != nil && req.Body != http.NoBody {
+		return nil, errors.New("httpclient: request body can't be read again")
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		buf, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(buf)) > 0 {
+			// keep numbers as-is rather than converting them to a float64
+			dec := json.NewDecoder(bytes.NewReader(buf))
+			dec.UseNumber()
+			if err := dec.Decode(&obj); err != nil {
+				return nil, err
+			}
+		}
+	}
+	keys := strings.Split(path, ".")
+	parent := obj
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := parent[key].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			parent[key] = child
+		}
+		parent = child
+	}
+	parent[keys[len(keys)-1]] = value
+	return json.Marshal(obj)
+}
+
+// OffsetPaginatorConfig is the configuration for a Paginator which uses offset and limit query parameters.
+// Pagination stops when a page has no items, when a page has fewer items than the limit or, if
+// TotalHeader is set, when the offset reaches the total number of items.
+type OffsetPaginatorConfig struct {
+	// OffsetParam is the name of the offset query parameter, defaults to offset
+	OffsetParam string
+	// LimitParam is the name of the limit query parameter, defaults to limit
+	LimitParam string
+	// Limit is the number of items per page which is used (and set on the next request) when the request has no limit
+	Limit int
+	// TotalHeader is the optional response header with the total number of items, such as X-Total-Count
+	TotalHeader string
+	// ItemsPath is the dot separated path of the array of items in the response body, the body itself when empty
+	ItemsPath string
+}
+
+type offsetPaginator struct {
+	config OffsetPaginatorConfig
+}
+
+// make sure it implements the interface
+var _ Paginator = (*offsetPaginator)(nil)
+var _ RangePaginator = (*offsetPaginator)(nil)
+
+// position returns the offset and limit of the request
+func (p *offsetPaginator) position(req *http.Request) (int, int) {
+	q := req.URL.Query()
+	offset, _ := strconv.Atoi(q.Get(p.config.OffsetParam))
+	limit := p.config.Limit
+	if v, err := strconv.Atoi(q.Get(p.config.LimitParam)); err == nil {
+		limit = v
+	}
+	return offset, limit
+}
+
+func (p *offsetPaginator) PageRequests(page int, req *http.Request, resp *http.Response) []*http.Request {
+	offset, limit := p.position(req)
+	total, err := strconv.Atoi(resp.Header.Get(p.config.TotalHeader))
+	if p.config.TotalHeader == "" || err != nil || limit <= 0 {
+		return nil
+	}
+	var reqs []*http.Request
+	for next := offset + limit; next < total; next += limit {
+		newreq := NextPageRequest(req, nil)
+		setQueryParam(newreq.URL, p.config.OffsetParam, strconv.Itoa(next))
+		setQueryParam(newreq.URL, p.config.LimitParam, strconv.Itoa(limit))
+		reqs = append(reqs, newreq)
+	}
+	return reqs
+}
+
+func (p *offsetPaginator) HasMore(page int, req *http.Request, resp *http.Response) (bool, *http.Request) {
+	offset, limit := p.position(req)
+	count, ok := countItems(resp, p.config.ItemsPath)
+	if !ok {
+		// assume a full page when we can't count the items
+		if limit <= 0 {
+			return false, nil
+		}
+		count = limit
+	}
+	if !hasMoreItems(count, ok, limit, offset+count, resp, p.config.TotalHeader) {
+		return false, nil
+	}
+	newreq := NextPageRequest(req, nil)
+	setQueryParam(newreq.URL, p.config.OffsetParam, strconv.Itoa(offset+count))
+	if limit > 0 {
+		setQueryParam(newreq.URL, p.config.LimitParam, strconv.Itoa(limit))
+	}
+	return true, newreq
+}
+
+// NewOffsetPaginator returns a new Paginator which pages through the items using offset and limit query parameters
+func NewOffsetPaginator(config OffsetPaginatorConfig) Paginator {
+	if config.OffsetParam == "" {
+		config.OffsetParam = "offset"
+	}
+	if config.LimitParam == "" {
+		config.LimitParam = "limit"
+	}
+	return &offsetPaginator{config}
+}
+
+// PagePaginatorConfig is the configuration for a Paginator which uses page number and page size query
+// parameters. Pagination stops when a page has no items, when a page has fewer items than the page size
+// or, if TotalHeader is set, when the pages fetched hold the total number of items.
+type PagePaginatorConfig struct {
+	// PageParam is the name of the page number query parameter, defaults to page
+	PageParam string
+	// PerPageParam is the name of the page size query parameter, defaults to per_page
+	PerPageParam string
+	// PerPage is the page size which is used (and set on the next request) when the request has no page size
+	PerPage int
+	// FirstPage is the number of the first page, defaults to 1
+	FirstPage int
+	// TotalHeader is the optional response header with the total number of items, such as X-Total-Count
+	TotalHeader string
+	// ItemsPath is the dot separated path of the array of items in the response body, the body itself when empty
+	ItemsPath string
+}
+
+type pagePaginator struct {
+	config PagePaginatorConfig
+}
+
+// make sure it implements the interface
+var _ Paginator = (*pagePaginator)(nil)
+var _ RangePaginator = (*pagePaginator)(nil)
+
+// position returns the page number and page size of the request
+func (p *pagePaginator) position(req *http.Request) (int, int) {
+	q := req.URL.Query()
+	current := p.config.FirstPage
+	if v, err := strconv.Atoi(q.Get(p.config.PageParam)); err == nil {
+		current = v
+	}
+	perPage := p.config.PerPage
+	if v, err := strconv.Atoi(q.Get(p.config.PerPageParam)); err == nil {
+		perPage = v
+	}
+	return current, perPage
+}
+
+func (p *pagePaginator) PageRequests(page int, req *http.Request, resp *http.Response) []*http.Request {
+	current, perPage := p.position(req)
+	total, err := strconv.Atoi(resp.Header.Get(p.config.TotalHeader))
+	if p.config.TotalHeader == "" || err != nil || perPage <= 0 {
+		return nil
+	}
+	var reqs []*http.Request
+	last := p.config.FirstPage + (total+perPage-1)/perPage - 1
+	for next := current + 1; next <= last; next++ {
+		newreq := NextPageRequest(req, nil)
+		setQueryParam(newreq.URL, p.config.PageParam, strconv.Itoa(next))
+		setQueryParam(newreq.URL, p.config.PerPageParam, strconv.Itoa(perPage))
+		reqs = append(reqs, newreq)
+	}
+	return reqs
+}
+
+func (p *pagePaginator) HasMore(page int, req *http.Request, resp *http.Response) (bool, *http.Request) {
+	current, perPage := p.position(req)
+	count, ok := countItems(resp, p.config.ItemsPath)
+	if !ok {
+		// assume a full page when we can't count the items
+		if perPage <= 0 {
+			return false, nil
+		}
+		count = perPage
+	}
+	fetched := (current-p.config.FirstPage)*perPage + count
+	if !hasMoreItems(count, ok, perPage, fetched, resp, p.config.TotalHeader) {
+		return false, nil
+	}
+	newreq := NextPageRequest(req, nil)
+	setQueryParam(newreq.URL, p.config.PageParam, strconv.Itoa(current+1))
+	if perPage > 0 {
+		setQueryParam(newreq.URL, p.config.PerPageParam, strconv.Itoa(perPage))
+	}
+	return true, newreq
+}
+
+// NewPagePaginator returns a new Paginator which pages through the items using page number and page size query parameters
+func NewPagePaginator(config PagePaginatorConfig) Paginator {
+	if config.PageParam == "" {
+		config.PageParam = "page"
+	}
+	if config.PerPageParam == "" {
+		config.PerPageParam = "per_page"
+	}
+	if config.FirstPage == 0 {
+		config.FirstPage = 1
+	}
+	return &pagePaginator{config}
+}
+
+// countItems returns the number of items in the array at the path of the JSON response body
+func countItems(resp *http.Response, path string) (int, bool) {
+	body, err := readBody(resp)
+	if err != nil {
+		return 0, false
+	}
+	if !json.Valid(body) {
+		return 0, false
+	}
+	items, ok := jsonPath(body, path)
+	if !ok {
+		// missing or null items are an empty page
+		return 0, true
+	}
+	var arr []json.RawMessage
+	if err := json.Unmarshal(items, &arr); err != nil {
+		return 0, false
+	}
+	return len(arr), true
+}
+
+// hasMoreItems returns false if the page had no items or fewer items than the page size. Otherwise
+// if the total header is set it returns true until the items fetched reach the total and if not
+// it returns true only if the items could be counted.
+func hasMoreItems(count int, counted bool, pageSize int, fetched int, resp *http.Response, totalHeader string) bool {
+	if counted && (count == 0 || (pageSize > 0 && count < pageSize)) {
+		return false
+	}
+	if totalHeader != "" {
+		if total, err := strconv.Atoi(resp.Header.Get(totalHeader)); err == nil {
+			return fetched < total
+		}
+	}
+	return counted
+}
@@ -1,8 +1,11 @@
 package httpclient
 
 import (
+	"context"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -44,3 +47,252 @@ func TestLinkPaginatorNone(t *testing.T) {
 	assert.False(ok)
 	assert.Nil(r)
 }
+
+func TestNewPageRequest(t *testing.T) {
+	assert := assert.New(t)
+	req, _ := http.NewRequest(http.MethodPost, "https://foo.com/graphql", strings.NewReader(`{"cursor":""}`))
+	req.Header.Set("Authorization", "Bearer 123")
+	newreq := NewPageRequest(req, []byte(`{"cursor":"abc"}`))
+	assert.Equal(http.MethodPost, newreq.Method)
+	assert.Equal("https://foo.com/graphql", newreq.URL.String())
+	assert.Equal("Bearer 123", newreq.Header.Get("Authorization"))
+	assert.Equal(int64(16), newreq.ContentLength)
+	newreq.Header.Set("X-Test", "1")
+	assert.Empty(req.Header.Get("X-Test"))
+	buf, _ := ioutil.ReadAll(newreq.Body)
+	assert.Equal(`{"cursor":"abc"}`, string(buf))
+	body, err := newreq.GetBody()
+	assert.NoError(err)
+	buf, _ = ioutil.ReadAll(body)
+	assert.Equal(`{"cursor":"abc"}`, string(buf))
+}
+
+func TestCursorPaginatorQuery(t *testing.T) {
+	assert := assert.New(t)
+	p := NewCursorPaginator(CursorPaginatorConfig{CursorPath: "meta.next_cursor", QueryParam: "cursor"})
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar?limit=10", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	resp := &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{"items":[1],"meta":{"next_cursor":"abc"}}`))}
+	ok, r := p.HasMore(1, req, resp)
+	assert.True(ok)
+	assert.Equal("https://foo.com/bar?cursor=abc&limit=10", r.URL.String())
+	assert.Equal("Bearer 123", r.Header.Get("Authorization"))
+	assert.Equal("https://foo.com/bar?limit=10", req.URL.String())
+	buf, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(`{"items":[1],"meta":{"next_cursor":"abc"}}`, string(buf))
+	ok, r = p.HasMore(2, r, &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{"meta":{"next_cursor":"abc"}}`))})
+	assert.False(ok)
+	assert.Nil(r)
+	ok, _ = p.HasMore(2, req, &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{"meta":{"next_cursor":""}}`))})
+	assert.False(ok)
+	ok, _ = p.HasMore(2, req, &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{"meta":{}}`))})
+	assert.False(ok)
+	ok, _ = p.HasMore(2, req, &http.Response{Body: ioutil.NopCloser(strings.NewReader(`not json`))})
+	assert.False(ok)
+	ok, r = p.HasMore(2, req, &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{"meta":{"next_cursor":42}}`))})
+	assert.True(ok)
+	assert.Equal("42", r.URL.Query().Get("cursor"))
+}
+
+func TestCursorPaginatorBody(t *testing.T) {
+	assert := assert.New(t)
+	p := NewCursorPaginator(CursorPaginatorConfig{
+		CursorPath:  "data.search.pageInfo.endCursor",
+		HasNextPath: "data.search.pageInfo.hasNextPage",
+		BodyField:   "variables.after",
+	})
+	assert.True(p.(MethodPaginator).PaginateMethod(http.MethodPost))
+	req, _ := http.NewRequest(http.MethodPost, "https://foo.com/graphql", strings.NewReader(`{"query":"q","variables":{"first":100,"id":12345678901234567}}`))
+	ok, r := p.HasMore(1, req, &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{"data":{"search":{"pageInfo":{"endCursor":"xyz","hasNextPage":true}}}}`))})
+	assert.True(ok)
+	buf, _ := ioutil.ReadAll(r.Body)
+	assert.JSONEq(`{"query":"q","variables":{"first":100,"id":12345678901234567,"after":"xyz"}}`, string(buf))
+	assert.Equal("https://foo.com/graphql", r.URL.String())
+	ok, r = p.HasMore(2, r, &http.Response{Body: ioutil.NopCloser(strings.NewReader(`{"data":{"search":{"pageInfo":{"endCursor":"xyz2","hasNextPage":false}}}}`))})
+	assert.False(ok)
+	assert.Nil(r)
+	q := NewCursorPaginator(CursorPaginatorConfig{CursorPath: "next", QueryParam: "cursor"})
+	assert.False(q.(MethodPaginator).PaginateMethod(http.MethodPost))
+	assert.True(q.(MethodPaginator).PaginateMethod(http.MethodGet))
+}
+
+func newTestResponse(body string, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: ioutil.NopCloser(strings.NewReader(body))}
+}
+
+func TestOffsetPaginator(t *testing.T) {
+	assert := assert.New(t)
+	p := NewOffsetPaginator(OffsetPaginatorConfig{Limit: 2})
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar?top=1", nil)
+	ok, r := p.HasMore(1, req, newTestResponse(`[1,2]`, nil))
+	assert.True(ok)
+	assert.Equal("https://foo.com/bar?limit=2&offset=2&top=1", r.URL.String())
+	ok, r = p.HasMore(2, r, newTestResponse(`[3,4]`, nil))
+	assert.True(ok)
+	assert.Equal("https://foo.com/bar?limit=2&offset=4&top=1", r.URL.String())
+	ok, _ = p.HasMore(3, r, newTestResponse(`[5]`, nil))
+	assert.False(ok)
+	ok, _ = p.HasMore(3, r, newTestResponse(`[]`, nil))
+	assert.False(ok)
+	ok, _ = p.HasMore(3, r, newTestResponse(`not json`, nil))
+	assert.False(ok)
+}
+
+func TestOffsetPaginatorTotal(t *testing.T) {
+	assert := assert.New(t)
+	p := NewOffsetPaginator(OffsetPaginatorConfig{OffsetParam: "start", LimitParam: "max", TotalHeader: "X-Total-Count", ItemsPath: "data"})
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar?max=2", nil)
+	header := http.Header{"X-Total-Count": []string{"4"}}
+	ok, r := p.HasMore(1, req, newTestResponse(`{"data":[1,2]}`, header))
+	assert.True(ok)
+	assert.Equal("https://foo.com/bar?max=2&start=2", r.URL.String())
+	ok, _ = p.HasMore(2, r, newTestResponse(`{"data":[3,4]}`, header))
+	assert.False(ok)
+	ok, r = p.HasMore(1, req, newTestResponse(`<xml/>`, header))
+	assert.True(ok)
+	assert.Equal("https://foo.com/bar?max=2&start=2", r.URL.String())
+	ok, _ = p.HasMore(1, req, newTestResponse(`{"data":null}`, header))
+	assert.False(ok)
+}
+
+func TestPagePaginator(t *testing.T) {
+	assert := assert.New(t)
+	p := NewPagePaginator(PagePaginatorConfig{PerPage: 2, TotalHeader: "X-Total-Count"})
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar?page=1&xpage=1", nil)
+	header := http.Header{"X-Total-Count": []string{"5"}}
+	ok, r := p.HasMore(1, req, newTestResponse(`[1,2]`, header))
+	assert.True(ok)
+	assert.Equal("https://foo.com/bar?page=2&per_page=2&xpage=1", r.URL.String())
+	ok, r = p.HasMore(2, r, newTestResponse(`[3,4]`, header))
+	assert.True(ok)
+	assert.Equal("https://foo.com/bar?page=3&per_page=2&xpage=1", r.URL.String())
+	ok, _ = p.HasMore(3, r, newTestResponse(`[5,6]`, header))
+	assert.False(ok)
+	p = NewPagePaginator(PagePaginatorConfig{PageParam: "p", PerPageParam: "size", FirstPage: 0})
+	req, _ = http.NewRequest(http.MethodGet, "https://foo.com/bar?size=10", nil)
+	ok, r = p.HasMore(1, req, newTestResponse(`[1,2,3,4,5,6,7,8,9,10]`, nil))
+	assert.True(ok)
+	assert.Equal("https://foo.com/bar?p=2&size=10", r.URL.String())
+	ok, _ = p.HasMore(2, r, newTestResponse(`[1]`, nil))
+	assert.False(ok)
+}
+
+func TestInBodyPaginator(t *testing.T) {
+	assert := assert.New(t)
+	p := InBodyPaginator()
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar?top=1&p=1", nil)
+	req.SetBasicAuth("user", "pass")
+	resp := newTestResponse(`{"paging":{"pageIndex":1,"pageSize":2,"total":3},"items":[1,2]}`, nil)
+	ok, r := p.HasMore(1, req, resp)
+	assert.True(ok)
+	assert.Equal("https://foo.com/bar?p=2&top=1", r.URL.String())
+	user, pass, _ := r.BasicAuth()
+	assert.Equal("user", user)
+	assert.Equal("pass", pass)
+	buf, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(`{"items":[1,2]},`, string(buf))
+	ok, _ = p.HasMore(2, r, newTestResponse(`{"paging":{"pageIndex":2,"pageSize":2,"total":3},"items":[3]}`, nil))
+	assert.False(ok)
+	req, _ = http.NewRequest(http.MethodGet, "https://foo.com/bar?p=10", nil)
+	ok, r = p.HasMore(10, req, newTestResponse(`{"paging":{"pageIndex":10,"pageSize":2,"total":30}}`, nil))
+	assert.True(ok)
+	assert.Equal("https://foo.com/bar?p=11", r.URL.String())
+}
+
+func TestLinkPaginatorRelative(t *testing.T) {
+	assert := assert.New(t)
+	p := NewLinkPaginator()
+	u, _ := url.Parse("https://foo.com/api/bar?page=1")
+	ok, r := p.HasMore(1, &http.Request{Method: http.MethodGet, URL: u, Header: http.Header{}}, &http.Response{
+		Header: http.Header{"Link": []string{`<https://foo.com/api/bar?page=1>; rel="prev first"`, `<bar?page=2&filter=a,b>; rel="next last"`}},
+	})
+	assert.True(ok)
+	assert.Equal("https://foo.com/api/bar?page=2&filter=a,b", r.URL.String())
+}
+
+func TestNextPageRequest(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.WithValue(context.Background(), testContextKey("a"), "b")
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar?page=1", nil)
+	req = req.WithContext(ctx)
+	req.Host = "internal.foo.com"
+	req.Close = true
+	req.Header.Set("Authorization", "Bearer 123")
+	req.Header.Set("X-Custom", "1")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	next, _ := url.Parse("https://foo.com/bar?page=2")
+	newreq := NextPageRequest(req, next)
+	assert.Equal("https://foo.com/bar?page=2", newreq.URL.String())
+	assert.Equal(ctx, newreq.Context())
+	assert.Equal("internal.foo.com", newreq.Host)
+	assert.False(newreq.Close)
+	assert.Equal("Bearer 123", newreq.Header.Get("Authorization"))
+	assert.Equal("1", newreq.Header.Get("X-Custom"))
+	cookie, err := newreq.Cookie("session")
+	assert.NoError(err)
+	assert.Equal("abc", cookie.Value)
+	newreq.Header.Set("X-Custom", "2")
+	assert.Equal("1", req.Header.Get("X-Custom"))
+	newreq = NextPageRequest(req, nil)
+	newreq.URL.RawQuery = "page=3"
+	assert.Equal("https://foo.com/bar?page=1", req.URL.String())
+	other, _ := url.Parse("https://evil.com/bar?page=2")
+	newreq = NextPageRequest(req, other)
+	assert.Empty(newreq.Header.Get("Authorization"))
+	assert.Empty(newreq.Header.Get("Cookie"))
+	assert.Empty(newreq.Host)
+	assert.Equal("1", newreq.Header.Get("X-Custom"))
+	assert.Equal(ctx, newreq.Context())
+}
+
+func TestNextPageRequestBody(t *testing.T) {
+	assert := assert.New(t)
+	req, _ := http.NewRequest(http.MethodPost, "https://foo.com/bar", strings.NewReader("page=1"))
+	ioutil.ReadAll(req.Body)
+	newreq := NextPageRequest(req, nil)
+	buf, _ := ioutil.ReadAll(newreq.Body)
+	assert.Equal("page=1", string(buf))
+	assert.Equal(int64(6), newreq.ContentLength)
+	// a body which can't be rewound isn't sent again
+	req, _ = http.NewRequest(http.MethodPost, "https://foo.com/bar", onlyReader{strings.NewReader("page=1")})
+	req.ContentLength = 6
+	ioutil.ReadAll(req.Body)
+	newreq = NextPageRequest(req, nil)
+	assert.Nil(newreq.Body)
+	assert.Equal(int64(0), newreq.ContentLength)
+	assert.NotNil(req.Body)
+	assert.Equal(int64(6), req.ContentLength)
+}
+
+func TestLinkPaginatorHeaders(t *testing.T) {
+	assert := assert.New(t)
+	p := NewLinkPaginator()
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar?page=1", nil)
+	req.Header.Set("Authorization", "Bearer 123")
+	ok, r := p.HasMore(1, req, &http.Response{
+		Header: http.Header{"Link": []string{`<https://foo.com/bar?page=2>; rel="next"`}},
+	})
+	assert.True(ok)
+	assert.Equal("Bearer 123", r.Header.Get("Authorization"))
+	r.Header.Set("X-Custom", "1")
+	assert.Empty(req.Header.Get("X-Custom"))
+	ok, r = p.HasMore(1, req, &http.Response{
+		Header: http.Header{"Link": []string{`<https://other.com/bar?page=2>; rel="next"`}},
+	})
+	assert.True(ok)
+	assert.Empty(r.Header.Get("Authorization"))
+}
+
+func TestOffsetPaginatorPageRequests(t *testing.T) {
+	assert := assert.New(t)
+	p := NewOffsetPaginator(OffsetPaginatorConfig{Limit: 10, TotalHeader: "X-Total-Count"}).(RangePaginator)
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	reqs := p.PageRequests(1, req, newTestResponse(`[]`, http.Header{"X-Total-Count": []string{"25"}}))
+	assert.Len(reqs, 2)
+	assert.Equal("https://foo.com/bar?limit=10&offset=10", reqs[0].URL.String())
+	assert.Equal("https://foo.com/bar?limit=10&offset=20", reqs[1].URL.String())
+	assert.Nil(p.PageRequests(1, req, newTestResponse(`[]`, nil)))
+}
@@ -0,0 +1,233 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiterConfig is the configuration for NewRateLimiter
+type RateLimiterConfig struct {
+	// Rate is the number of requests per second allowed for each key
+	Rate float64
+	// Burst is the number of requests which can be sent at once, defaults to 1
+	Burst int
+	// Key returns the key of the limit for the request, defaults to the host of the request URL
+	Key func(req *http.Request) string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type tokenBucketLimiter struct {
+	config  RateLimiterConfig
+	now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// make sure it implements the interface
+var _ RateLimiter = (*tokenBucketLimiter)(nil)
+
+// NewRateLimiter returns a token bucket RateLimiter with a bucket per host (or per key)
+func NewRateLimiter(config RateLimiterConfig) RateLimiter {
+	if config.Burst <= 0 {
+		config.Burst = 1
+	}
+	if config.Key == nil {
+		config.Key = HostKey
+	}
+	return &tokenBucketLimiter{
+		config:  config,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// reserve takes a token from the bucket for the key and returns how long to wait before it can be used
+func (l *tokenBucketLimiter) reserve(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: float64(l.config.Burst), last: now}
+		l.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * l.config.Rate
+		if b.tokens > float64(l.config.Burst) {
+			b.tokens = float64(l.config.Burst)
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.config.Rate * float64(time.Second))
+}
+
+// cancel returns a token which wasn't used to the bucket for the key
+func (l *tokenBucketLimiter) cancel(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b := l.buckets[key]; b != nil {
+		b.tokens++
+	}
+}
+
+func (l *tokenBucketLimiter) Wait(ctx context.Context, req *http.Request) error {
+	if l.config.Rate <= 0 {
+		return nil
+	}
+	key := l.config.Key(req)
+	delay := l.reserve(key)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.cancel(key)
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// AdaptiveRateLimiterConfig is the configuration for NewAdaptiveRateLimiter
+type AdaptiveRateLimiterConfig struct {
+	// Key returns the key of the quota for the request, defaults to the host of the request URL
+	Key func(req *http.Request) string
+	// MinRemaining pauses the requests once the remaining quota is at or below it until the quota resets
+	MinRemaining int
+	// Pace when true spreads the requests evenly over the remaining quota until it resets instead
+	// of sending them as fast as possible until the quota is used up
+	Pace bool
+}
+
+type quota struct {
+	remaining int
+	reset     time.Time
+	next      time.Time
+}
+
+type adaptiveLimiter struct {
+	config AdaptiveRateLimiterConfig
+	now    func() time.Time
+	mu     sync.Mutex
+	quotas map[string]*quota
+}
+
+// make sure it implements the interfaces
+var _ RateLimiter = (*adaptiveLimiter)(nil)
+var _ ResponseObserver = (*adaptiveLimiter)(nil)
+
+// NewAdaptiveRateLimiter returns a RateLimiter which reads the remaining quota and the reset from
+// the X-RateLimit-Remaining/X-RateLimit-Reset (or RateLimit-Remaining/RateLimit-Reset) headers of
+// each response and slows down or pauses the requests for the host (or key) until the quota resets.
+// A rate limited response pauses the requests for the delay the server asks for.
+func NewAdaptiveRateLimiter(config AdaptiveRateLimiterConfig) RateLimiter {
+	if config.Key == nil {
+		config.Key = HostKey
+	}
+	return &adaptiveLimiter{
+		config: config,
+		now:    time.Now,
+		quotas: make(map[string]*quota),
+	}
+}
+
+// reserve uses one of the remaining quota for the key and returns how long to wait before sending the request
+func (l *adaptiveLimiter) reserve(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	q := l.quotas[key]
+	if q == nil {
+		return 0
+	}
+	if !q.reset.After(now) {
+		// the quota has reset so we don't know what's left until the next response
+		delete(l.quotas, key)
+		return 0
+	}
+	if q.remaining <= l.config.MinRemaining {
+		return q.reset.Sub(now)
+	}
+	var delay time.Duration
+	if l.config.Pace {
+		// spread the remaining quota evenly from the next free slot until the reset
+		if q.next.Before(now) {
+			q.next = now
+		}
+		delay = q.next.Sub(now)
+		if interval := q.reset.Sub(q.next) / time.Duration(q.remaining-l.config.MinRemaining); interval > 0 {
+			q.next = q.next.Add(interval)
+		}
+	}
+	q.remaining--
+	return delay
+}
+
+func (l *adaptiveLimiter) Wait(ctx context.Context, req *http.Request) error {
+	delay := l.reserve(l.config.Key(req))
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (l *adaptiveLimiter) Observe(req *http.Request, resp *http.Response) {
+	remaining, reset, ok := rateLimitQuota(resp)
+	if IsRateLimited(resp) {
+		if delay, limited := RetryAfter(resp); limited {
+			remaining, reset, ok = 0, delay, true
+		}
+	}
+	if !ok {
+		return
+	}
+	key := l.config.Key(req)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	q := l.quotas[key]
+	if q == nil {
+		q = &quota{}
+		l.quotas[key] = q
+	}
+	q.remaining = remaining
+	q.reset = l.now().Add(reset)
+}
+
+// rateLimitQuota returns the remaining quota and the delay until it resets from the response headers
+func rateLimitQuota(resp *http.Response) (int, time.Duration, bool) {
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		v := strings.TrimSpace(resp.Header.Get(prefix + "Remaining"))
+		if v == "" {
+			continue
+		}
+		remaining, err := strconv.Atoi(v)
+		if err != nil {
+			continue
+		}
+		if reset, ok := rateLimitReset(resp, prefix); ok {
+			return remaining, reset, true
+		}
+	}
+	return 0, 0, false
+}
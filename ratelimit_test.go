@@ -0,0 +1,211 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	assert := assert.New(t)
+	clock := &testClock{now: time.Now()}
+	l := NewRateLimiter(RateLimiterConfig{Rate: 10, Burst: 2}).(*tokenBucketLimiter)
+	l.now = clock.Now
+	assert.Equal(time.Duration(0), l.reserve("foo.com"))
+	assert.Equal(time.Duration(0), l.reserve("foo.com"))
+	assert.Equal(100*time.Millisecond, l.reserve("foo.com"))
+	assert.Equal(200*time.Millisecond, l.reserve("foo.com"))
+	// each key has its own bucket
+	assert.Equal(time.Duration(0), l.reserve("other.com"))
+	l.cancel("foo.com")
+	clock.now = clock.now.Add(time.Second)
+	assert.Equal(time.Duration(0), l.reserve("foo.com"))
+	assert.Equal(time.Duration(0), l.reserve("foo.com"))
+	assert.Equal(100*time.Millisecond, l.reserve("foo.com"))
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	assert := assert.New(t)
+	l := NewRateLimiter(RateLimiterConfig{Rate: 100})
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(l.Wait(context.Background(), req))
+	}
+	assert.True(time.Since(started) >= 20*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	l = NewRateLimiter(RateLimiterConfig{Rate: 0.1})
+	assert.NoError(l.Wait(ctx, req))
+	assert.Equal(context.DeadlineExceeded, l.Wait(ctx, req))
+}
+
+func TestDoRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+	var sent []time.Time
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		sent = append(sent, time.Now())
+		if len(sent) < 3 {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	config := NewConfig()
+	config.Retryable = NewBackoffRetry(0, 0, time.Second, 0)
+	config.RateLimiter = NewRateLimiter(RateLimiterConfig{Rate: 50})
+	client := NewHTTPClient(nil, config, tc)
+	resp, err := client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Len(sent, 3)
+	assert.True(sent[2].Sub(sent[0]) >= 35*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err = client.GetContext(ctx, "https://foo.com/bar")
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+}
+
+type testRateLimiter func(ctx context.Context, req *http.Request) error
+
+func (l testRateLimiter) Wait(ctx context.Context, req *http.Request) error {
+	return l(ctx, req)
+}
+
+func TestDoRateLimiterError(t *testing.T) {
+	assert := assert.New(t)
+	limitErr := errors.New("quota exceeded")
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	})
+	config := NewConfig()
+	config.RateLimiter = testRateLimiter(func(ctx context.Context, req *http.Request) error {
+		return limitErr
+	})
+	client := NewHTTPClient(nil, config, tc)
+	// an error which isn't the context's is returned as is
+	_, err := client.Get("https://foo.com/bar")
+	assert.Equal(limitErr, err)
+}
+
+func TestDoRateLimiterCircuitOpen(t *testing.T) {
+	assert := assert.New(t)
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusBadGateway}, nil
+	})
+	b, clock := newTestCircuitBreaker(CircuitBreakerConfig{ConsecutiveFailures: 1})
+	config := NewConfig()
+	config.CircuitBreaker = b
+	config.RateLimiter = NewRateLimiter(RateLimiterConfig{Rate: 0.1})
+	client := NewHTTPClient(nil, config, tc)
+	_, err := client.Get("https://foo.com/bar")
+	assert.NoError(err)
+	assert.Equal(CircuitOpen, b.State("foo.com"))
+	// an open circuit fails right away instead of waiting for a token
+	started := time.Now()
+	_, err = client.Get("https://foo.com/bar")
+	assert.True(errors.Is(err, ErrCircuitOpen))
+	assert.True(time.Since(started) < time.Second)
+	// a probe which gives up waiting for a token doesn't count against the circuit
+	clock.now = clock.now.Add(DefaultCircuitOpenDuration)
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		_, err = client.GetContext(ctx, "https://foo.com/bar")
+		cancel()
+		assert.True(errors.Is(err, context.DeadlineExceeded))
+		assert.Equal(CircuitHalfOpen, b.State("foo.com"))
+	}
+}
+
+func TestAdaptiveRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+	clock := &testClock{now: time.Now()}
+	l := NewAdaptiveRateLimiter(AdaptiveRateLimiterConfig{MinRemaining: 1}).(*adaptiveLimiter)
+	l.now = clock.Now
+	req, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos", nil)
+	assert.Equal(time.Duration(0), l.reserve("api.github.com"))
+	l.Observe(req, &http.Response{StatusCode: http.StatusOK, Header: http.Header{
+		"X-Ratelimit-Remaining": []string{"3"},
+		"X-Ratelimit-Reset":     []string{"60"},
+	}})
+	assert.Equal(time.Duration(0), l.reserve("api.github.com"))
+	assert.Equal(time.Duration(0), l.reserve("api.github.com"))
+	assert.Equal(time.Minute, l.reserve("api.github.com"))
+	assert.Equal(time.Duration(0), l.reserve("other.com"))
+	clock.now = clock.now.Add(time.Minute)
+	assert.Equal(time.Duration(0), l.reserve("api.github.com"))
+	// a secondary rate limit pauses for the advertised delay
+	l.Observe(req, &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{
+		"Retry-After":           []string{"30"},
+		"X-Ratelimit-Remaining": []string{"4000"},
+		"X-Ratelimit-Reset":     []string{"3600"},
+	}})
+	assert.Equal(30*time.Second, l.reserve("api.github.com"))
+}
+
+func TestAdaptiveRateLimiterPace(t *testing.T) {
+	assert := assert.New(t)
+	clock := &testClock{now: time.Now()}
+	l := NewAdaptiveRateLimiter(AdaptiveRateLimiterConfig{Pace: true}).(*adaptiveLimiter)
+	l.now = clock.Now
+	req, _ := http.NewRequest(http.MethodGet, "https://foo.com/bar", nil)
+	l.Observe(req, &http.Response{StatusCode: http.StatusOK, Header: http.Header{
+		"Ratelimit-Remaining": []string{"4"},
+		"Ratelimit-Reset":     []string{"8"},
+	}})
+	assert.Equal(time.Duration(0), l.reserve("foo.com"))
+	assert.Equal(2*time.Second, l.reserve("foo.com"))
+	clock.now = clock.now.Add(2 * time.Second)
+	assert.Equal(2*time.Second, l.reserve("foo.com"))
+	assert.Equal(4*time.Second, l.reserve("foo.com"))
+	// the quota is used up until the reset
+	assert.Equal(6*time.Second, l.reserve("foo.com"))
+}
+
+func TestDoSecondaryRateLimit(t *testing.T) {
+	assert := assert.New(t)
+	var count int
+	tc := ClientFunc(func(req *http.Request) (*http.Response, error) {
+		count++
+		if req.URL.Host == "other.com" {
+			return &http.Response{StatusCode: http.StatusForbidden}, nil
+		}
+		if count == 1 {
+			return &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{"Retry-After": []string{"0"}}}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{
+			"X-Ratelimit-Remaining": []string{"0"},
+			"X-Ratelimit-Reset":     []string{"60"},
+		}}, nil
+	})
+	config := NewConfig()
+	config.Retryable = NewRetryAfterRetry(NewBackoffRetry(time.Second, time.Second, time.Second, 1))
+	config.RateLimiter = NewAdaptiveRateLimiter(AdaptiveRateLimiterConfig{})
+	client := NewHTTPClient(nil, config, tc)
+	// a rate limited 403 is terminal by default
+	resp, err := client.Get("https://api.github.com/repos")
+	assert.NoError(err)
+	assert.Equal(http.StatusForbidden, resp.StatusCode)
+	assert.Equal(1, count)
+	count = 0
+	config.RateLimiter = NewAdaptiveRateLimiter(AdaptiveRateLimiterConfig{})
+	config.StatusPolicy = RetryRateLimited(DefaultStatusPolicy())
+	resp, err = client.Get("https://api.github.com/repos")
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(2, count)
+	// the quota is used up so the next request waits for the reset
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.GetContext(ctx, "https://api.github.com/repos")
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(2, count)
+	// a 403 without rate limit headers is still terminal
+	resp, err = client.Get("https://other.com/forbidden")
+	assert.NoError(err)
+	assert.Equal(http.StatusForbidden, resp.StatusCode)
+	assert.Equal(3, count)
+}
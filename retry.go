@@ -1,8 +1,19 @@
 package httpclient
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
 	"math"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -42,7 +53,7 @@ type backoffRetry struct {
 var _ Retryable = (*backoffRetry)(nil)
 
 func (r *backoffRetry) RetryError(err error) bool {
-	return true
+	return IsTemporaryError(err)
 }
 
 func (r *backoffRetry) RetryResponse(resp *http.Response) bool {
@@ -57,6 +68,50 @@ func (r *backoffRetry) RetryMaxDuration() time.Duration {
 	return time.Duration(r.maxTimeout)
 }
 
+// IsTemporaryError returns true if the error returned from sending a request is likely to be
+// temporary and the request worth retrying, such as a timeout, a reset or refused connection,
+// an EOF from a closed keep-alive connection or a temporary DNS failure. Errors such as an invalid
+// certificate, a malformed URL, a cancelled context or exhausted retries (ErrRequestTimeout) are
+// permanent, as is any unrecognized error.
+func IsTemporaryError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrRequestTimeout) {
+		// the retries are already exhausted, such as by an HTTPClient wrapped in another
+		return false
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr.Op == "parse" {
+		return false
+	}
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var certInvalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	var recordHeaderErr tls.RecordHeaderError
+	if errors.As(err, &unknownAuthorityErr) || errors.As(err, &certInvalidErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &recordHeaderErr) {
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ETIMEDOUT) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return false
+}
+
 // NewBackoffRetry will return a Retryable that will support expotential backoff
 func NewBackoffRetry(initialTimeout time.Duration, incrementingTimeout time.Duration, maxTimeout time.Duration, exponentFactor float64) Retryable {
 	return &backoffRetry{
@@ -66,3 +121,303 @@ func NewBackoffRetry(initialTimeout time.Duration, incrementingTimeout time.Dura
 		maxTimeout:          float64(maxTimeout),
 	}
 }
+
+type jitterStrategy int
+
+const (
+	fullJitter jitterStrategy = iota
+	equalJitter
+	decorrelatedJitter
+)
+
+// globalRand uses the goroutine safe top-level math/rand functions
+type globalRand struct{}
+
+func (globalRand) Int63n(n int64) int64 {
+	return rand.Int63n(n)
+}
+
+type jitterRetry struct {
+	strategy    jitterStrategy
+	base        time.Duration
+	maxDelay    time.Duration
+	maxDuration time.Duration
+	random      RandomSource
+}
+
+var _ Retryable = (*jitterRetry)(nil)
+var _ RequestRetryable = (*jitterRetry)(nil)
+
+func (r *jitterRetry) RetryError(err error) bool {
+	return IsTemporaryError(err)
+}
+
+func (r *jitterRetry) RetryResponse(resp *http.Response) bool {
+	return true
+}
+
+// between returns a random duration in the range [min, max]
+func (r *jitterRetry) between(min time.Duration, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(r.random.Int63n(int64(max-min)+1))
+}
+
+func (r *jitterRetry) RetryDelay(retry int) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+	// use float math so a large number of retries can't overflow the exponent
+	ceiling := time.Duration(math.Min(float64(r.base)*math.Pow(2, float64(retry-1)), float64(r.maxDelay)))
+	switch r.strategy {
+	case equalJitter:
+		return r.between(ceiling/2, ceiling)
+	case decorrelatedJitter:
+		// without the previous delay the range grows as if each delay was the largest possible
+		prev := time.Duration(math.Min(float64(r.base)*math.Pow(3, float64(retry-1)), float64(r.maxDelay)))
+		return r.RetryRequestDelay(retry, prev, nil)
+	}
+	return r.between(0, ceiling)
+}
+
+func (r *jitterRetry) RetryRequestDelay(retry int, prev time.Duration, resp *http.Response) time.Duration {
+	if r.strategy != decorrelatedJitter {
+		return r.RetryDelay(retry)
+	}
+	if retry <= 1 || prev < r.base {
+		prev = r.base
+	}
+	// multiply in float to avoid an overflow of a large previous delay
+	upper := time.Duration(math.Min(float64(prev)*3, float64(r.maxDelay)))
+	return r.between(r.base, upper)
+}
+
+func (r *jitterRetry) RetryMaxDuration() time.Duration {
+	return r.maxDuration
+}
+
+func newJitterRetry(strategy jitterStrategy, base time.Duration, maxDelay time.Duration, maxDuration time.Duration, random RandomSource) Retryable {
+	if maxDelay <= 0 {
+		maxDelay = maxDuration
+	}
+	if base > maxDelay {
+		base = maxDelay
+	}
+	if random == nil {
+		random = globalRand{}
+	}
+	return &jitterRetry{
+		strategy:    strategy,
+		base:        base,
+		maxDelay:    maxDelay,
+		maxDuration: maxDuration,
+		random:      random,
+	}
+}
+
+// NewFullJitterRetry will return a Retryable with exponential backoff where each delay is a random
+// duration between 0 and base*2^(retry-1), capped at maxDelay. If random is nil the top-level
+// math/rand functions are used. A *rand.Rand isn't safe for concurrent use so it shouldn't be
+// passed in when the HTTPClient is shared between goroutines.
+func NewFullJitterRetry(base time.Duration, maxDelay time.Duration, maxDuration time.Duration, random RandomSource) Retryable {
+	return newJitterRetry(fullJitter, base, maxDelay, maxDuration, random)
+}
+
+// NewEqualJitterRetry will return a Retryable with exponential backoff where each delay is half of
+// base*2^(retry-1), capped at maxDelay, plus a random duration up to the other half
+func NewEqualJitterRetry(base time.Duration, maxDelay time.Duration, maxDuration time.Duration, random RandomSource) Retryable {
+	return newJitterRetry(equalJitter, base, maxDelay, maxDuration, random)
+}
+
+// NewDecorrelatedJitterRetry will return a Retryable where each delay is a random duration between base
+// and three times the previous delay of the same request, capped at maxDelay
+func NewDecorrelatedJitterRetry(base time.Duration, maxDelay time.Duration, maxDuration time.Duration, random RandomSource) Retryable {
+	return newJitterRetry(decorrelatedJitter, base, maxDelay, maxDuration, random)
+}
+
+type retryAfterRetry struct {
+	Retryable
+}
+
+var _ Retryable = (*retryAfterRetry)(nil)
+var _ ResponseRetryable = (*retryAfterRetry)(nil)
+var _ RequestRetryable = (*retryAfterRetry)(nil)
+
+func (r *retryAfterRetry) RetryResponseDelay(retry int, resp *http.Response) time.Duration {
+	return r.RetryRequestDelay(retry, 0, resp)
+}
+
+func (r *retryAfterRetry) RetryRequestDelay(retry int, prev time.Duration, resp *http.Response) time.Duration {
+	if delay, ok := RetryAfter(resp); ok {
+		if max := r.RetryMaxDuration(); delay > max {
+			return max
+		}
+		return delay
+	}
+	if rr, ok := r.Retryable.(RequestRetryable); ok {
+		return rr.RetryRequestDelay(retry, prev, resp)
+	}
+	if rr, ok := r.Retryable.(ResponseRetryable); ok {
+		return rr.RetryResponseDelay(retry, resp)
+	}
+	return r.RetryDelay(retry)
+}
+
+// NewRetryAfterRetry will return a Retryable which waits for the delay the server asks for
+// in the Retry-After or rate limit reset headers, capped by RetryMaxDuration. When the response
+// has no such header the delay from the passed in Retryable is used. When the delay is at least
+// what's left of RetryMaxDuration, Do returns a *RetryExhaustedError right away instead of waiting.
+func NewRetryAfterRetry(retryable Retryable) Retryable {
+	return &retryAfterRetry{retryable}
+}
+
+// RetryAfter returns the delay the server asked for in the response. The Retry-After header is
+// used if present (either in seconds or as an HTTP-date) and otherwise, for a 429 response or when
+// the remaining quota is exhausted, the X-RateLimit-Reset (epoch or seconds) or RateLimit-Reset header.
+func RetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	if v := strings.TrimSpace(resp.Header.Get("Retry-After")); v != "" {
+		if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return nonNegative(time.Duration(secs) * time.Second), true
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return nonNegative(time.Until(t)), true
+		}
+	}
+	limited := resp.StatusCode == http.StatusTooManyRequests
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if limited || resp.Header.Get(prefix+"Remaining") == "0" {
+			if reset, ok := rateLimitReset(resp, prefix); ok {
+				return reset, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// rateLimitReset returns the delay until the rate limit resets from the X-RateLimit-Reset (epoch or
+// seconds) or the RateLimit-Reset (seconds) header, depending on the prefix
+func rateLimitReset(resp *http.Response, prefix string) (time.Duration, bool) {
+	v := strings.TrimSpace(resp.Header.Get(prefix + "Reset"))
+	if v == "" {
+		return 0, false
+	}
+	reset, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	// some APIs (such as GitHub) send the epoch time in seconds of the reset while others
+	// send the number of seconds until the reset
+	if prefix == "X-RateLimit-" && reset > 1000000000 {
+		return nonNegative(time.Until(time.Unix(reset, 0))), true
+	}
+	return nonNegative(time.Duration(reset) * time.Second), true
+}
+
+// IsRateLimited returns true if the response says a rate limit was hit, either a 429 or a 403
+// which tells when to retry with a Retry-After header or an exhausted remaining quota, as GitHub
+// sends for its primary and secondary rate limits
+func IsRateLimited(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return resp.Header.Get("Retry-After") != "" ||
+			resp.Header.Get("X-RateLimit-Remaining") == "0" ||
+			resp.Header.Get("RateLimit-Remaining") == "0"
+	}
+	return false
+}
+
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// DefaultTerminalStatusCodes are the non-2xx status codes which are returned as-is by
+// the DefaultStatusPolicy without attempting a retry
+var DefaultTerminalStatusCodes = []int{
+	http.StatusUnauthorized,
+	http.StatusPaymentRequired,
+	http.StatusForbidden,
+	http.StatusNotFound,
+	http.StatusMethodNotAllowed,
+	http.StatusPermanentRedirect,
+	http.StatusTemporaryRedirect,
+	http.StatusConflict,
+	http.StatusRequestEntityTooLarge,
+	http.StatusRequestedRangeNotSatisfiable,
+	http.StatusRequestHeaderFieldsTooLarge,
+	http.StatusBadRequest,
+	http.StatusUnprocessableEntity,
+	http.StatusInternalServerError,
+}
+
+// StatusPolicyFunc is a func which implements the StatusPolicy interface
+type StatusPolicyFunc func(statusCode int) bool
+
+var _ StatusPolicy = (StatusPolicyFunc)(nil)
+
+// Terminal returns true if the status code is terminal
+func (f StatusPolicyFunc) Terminal(statusCode int) bool {
+	return f(statusCode)
+}
+
+type statusCodePolicy struct {
+	terminal map[int]bool
+}
+
+var _ StatusPolicy = (*statusCodePolicy)(nil)
+
+func (p *statusCodePolicy) Terminal(statusCode int) bool {
+	return (statusCode >= 200 && statusCode < 300) || p.terminal[statusCode]
+}
+
+// NewStatusPolicy will return a StatusPolicy where any 2xx status code and the status codes passed in are terminal
+func NewStatusPolicy(terminal ...int) StatusPolicy {
+	p := &statusCodePolicy{make(map[int]bool)}
+	for _, code := range terminal {
+		p.terminal[code] = true
+	}
+	return p
+}
+
+// DefaultStatusPolicy will return the StatusPolicy used when none is set on the Config
+func DefaultStatusPolicy() StatusPolicy {
+	return NewStatusPolicy(DefaultTerminalStatusCodes...)
+}
+
+// RetryStatusCodes will return a StatusPolicy which treats the status codes passed in as
+// retryable and otherwise defers to policy, for example to retry on a 500 from a service
+// where those are transient: RetryStatusCodes(DefaultStatusPolicy(), http.StatusInternalServerError)
+func RetryStatusCodes(policy StatusPolicy, retryable ...int) StatusPolicy {
+	codes := make(map[int]bool)
+	for _, code := range retryable {
+		codes[code] = true
+	}
+	return StatusPolicyFunc(func(statusCode int) bool {
+		return !codes[statusCode] && policy.Terminal(statusCode)
+	})
+}
+
+type rateLimitedPolicy struct {
+	StatusPolicy
+}
+
+var _ ResponseStatusPolicy = (*rateLimitedPolicy)(nil)
+
+func (p *rateLimitedPolicy) TerminalResponse(resp *http.Response) bool {
+	return !IsRateLimited(resp) && p.Terminal(resp.StatusCode)
+}
+
+// RetryRateLimited will return a StatusPolicy which treats a response telling that a rate limit was
+// hit, such as a 403 from GitHub for its secondary rate limits, as retryable and otherwise defers to
+// policy. Use it with NewRetryAfterRetry to wait for the delay the server asks for before the retry.
+func RetryRateLimited(policy StatusPolicy) StatusPolicy {
+	return &rateLimitedPolicy{policy}
+}
@@ -1,7 +1,18 @@
 package httpclient
 
 import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -31,7 +42,7 @@ func TestNoRetryNew(t *testing.T) {
 func TestBackoffRetry(t *testing.T) {
 	assert := assert.New(t)
 	retry := NewBackoffRetry(time.Millisecond, 10*time.Millisecond, time.Second, 1.5)
-	assert.True(retry.RetryError(ErrRequestTimeout))
+	assert.True(retry.RetryError(timeoutError{}))
 	assert.True(retry.RetryResponse(&http.Response{}))
 	assert.Equal(time.Duration(25000000), retry.RetryDelay(1))
 	assert.Equal(time.Duration(32500000), retry.RetryDelay(2))
@@ -39,3 +50,182 @@ func TestBackoffRetry(t *testing.T) {
 	assert.Equal(time.Duration(60625000), retry.RetryDelay(4))
 	assert.Equal(time.Second, retry.RetryMaxDuration())
 }
+
+func TestRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+	d, ok := RetryAfter(nil)
+	assert.False(ok)
+	d, ok = RetryAfter(&http.Response{Header: http.Header{"Retry-After": []string{"30"}}})
+	assert.True(ok)
+	assert.Equal(30*time.Second, d)
+	d, ok = RetryAfter(&http.Response{Header: http.Header{"Retry-After": []string{time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}}})
+	assert.True(ok)
+	assert.True(d > 58*time.Second && d <= time.Minute)
+	d, ok = RetryAfter(&http.Response{Header: http.Header{"Retry-After": []string{"Wed, 21 Oct 2015 07:28:00 GMT"}}})
+	assert.True(ok)
+	assert.Equal(time.Duration(0), d)
+	d, ok = RetryAfter(&http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"X-Ratelimit-Reset": []string{"5"}}})
+	assert.True(ok)
+	assert.Equal(5*time.Second, d)
+	reset := strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)
+	d, ok = RetryAfter(&http.Response{StatusCode: http.StatusForbidden, Header: http.Header{"X-Ratelimit-Reset": []string{reset}, "X-Ratelimit-Remaining": []string{"0"}}})
+	assert.True(ok)
+	assert.True(d > 58*time.Second && d <= time.Minute)
+	d, ok = RetryAfter(&http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"X-Ratelimit-Reset": []string{reset}, "X-Ratelimit-Remaining": []string{"10"}}})
+	assert.False(ok)
+	d, ok = RetryAfter(&http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Ratelimit-Reset": []string{"7"}}})
+	assert.True(ok)
+	assert.Equal(7*time.Second, d)
+}
+
+func TestIsRateLimited(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsRateLimited(&http.Response{StatusCode: http.StatusTooManyRequests}))
+	assert.True(IsRateLimited(&http.Response{StatusCode: http.StatusForbidden, Header: http.Header{"Retry-After": []string{"60"}}}))
+	assert.True(IsRateLimited(&http.Response{StatusCode: http.StatusForbidden, Header: http.Header{"X-Ratelimit-Remaining": []string{"0"}}}))
+	assert.True(IsRateLimited(&http.Response{StatusCode: http.StatusForbidden, Header: http.Header{"Ratelimit-Remaining": []string{"0"}}}))
+	assert.False(IsRateLimited(&http.Response{StatusCode: http.StatusForbidden, Header: http.Header{"X-Ratelimit-Remaining": []string{"10"}}}))
+	assert.False(IsRateLimited(&http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": []string{"60"}}}))
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	assert := assert.New(t)
+	policy := RetryRateLimited(NewStatusPolicy(http.StatusForbidden)).(ResponseStatusPolicy)
+	assert.True(policy.TerminalResponse(&http.Response{StatusCode: http.StatusOK}))
+	assert.True(policy.TerminalResponse(&http.Response{StatusCode: http.StatusForbidden}))
+	assert.False(policy.TerminalResponse(&http.Response{StatusCode: http.StatusForbidden, Header: http.Header{"Retry-After": []string{"60"}}}))
+	assert.False(policy.TerminalResponse(&http.Response{StatusCode: http.StatusBadGateway}))
+}
+
+func TestRetryAfterRetry(t *testing.T) {
+	assert := assert.New(t)
+	retry := NewRetryAfterRetry(NewBackoffRetry(time.Millisecond, 10*time.Millisecond, time.Second, 1.5))
+	assert.True(retry.RetryResponse(&http.Response{}))
+	assert.Equal(time.Second, retry.RetryMaxDuration())
+	rr := retry.(ResponseRetryable)
+	assert.Equal(time.Duration(25000000), rr.RetryResponseDelay(1, nil))
+	assert.Equal(time.Duration(25000000), rr.RetryResponseDelay(1, &http.Response{StatusCode: http.StatusServiceUnavailable}))
+	assert.Equal(time.Second, rr.RetryResponseDelay(1, &http.Response{Header: http.Header{"Retry-After": []string{"30"}}}))
+	assert.Equal(time.Duration(0), rr.RetryResponseDelay(1, &http.Response{Header: http.Header{"Retry-After": []string{"0"}}}))
+}
+
+func TestDefaultStatusPolicy(t *testing.T) {
+	assert := assert.New(t)
+	policy := DefaultStatusPolicy()
+	assert.True(policy.Terminal(http.StatusOK))
+	assert.True(policy.Terminal(http.StatusNoContent))
+	assert.True(policy.Terminal(http.StatusNotFound))
+	assert.True(policy.Terminal(http.StatusInternalServerError))
+	assert.False(policy.Terminal(http.StatusBadGateway))
+	assert.False(policy.Terminal(http.StatusTooManyRequests))
+	assert.False(policy.Terminal(http.StatusNotImplemented))
+}
+
+func TestNewStatusPolicy(t *testing.T) {
+	assert := assert.New(t)
+	policy := NewStatusPolicy(http.StatusNotFound)
+	assert.True(policy.Terminal(http.StatusCreated))
+	assert.True(policy.Terminal(http.StatusNotFound))
+	assert.False(policy.Terminal(http.StatusInternalServerError))
+}
+
+func TestRetryStatusCodes(t *testing.T) {
+	assert := assert.New(t)
+	policy := RetryStatusCodes(DefaultStatusPolicy(), http.StatusInternalServerError)
+	assert.True(policy.Terminal(http.StatusOK))
+	assert.True(policy.Terminal(http.StatusNotFound))
+	assert.False(policy.Terminal(http.StatusInternalServerError))
+	policy = StatusPolicyFunc(func(statusCode int) bool { return statusCode < 500 })
+	assert.True(policy.Terminal(http.StatusBadRequest))
+	assert.False(policy.Terminal(http.StatusInternalServerError))
+}
+
+// maxRand always returns the highest value in the range
+type maxRand struct{}
+
+func (maxRand) Int63n(n int64) int64 {
+	return n - 1
+}
+
+func TestFullJitterRetry(t *testing.T) {
+	assert := assert.New(t)
+	retry := NewFullJitterRetry(10*time.Millisecond, 50*time.Millisecond, time.Second, maxRand{})
+	assert.True(retry.RetryError(timeoutError{}))
+	assert.True(retry.RetryResponse(&http.Response{}))
+	assert.Equal(10*time.Millisecond, retry.RetryDelay(1))
+	assert.Equal(20*time.Millisecond, retry.RetryDelay(2))
+	assert.Equal(40*time.Millisecond, retry.RetryDelay(3))
+	assert.Equal(50*time.Millisecond, retry.RetryDelay(4))
+	assert.Equal(50*time.Millisecond, retry.RetryDelay(1000))
+	assert.Equal(time.Second, retry.RetryMaxDuration())
+	retry = NewFullJitterRetry(10*time.Millisecond, 50*time.Millisecond, time.Second, rand.New(rand.NewSource(1)))
+	for i := 1; i < 10; i++ {
+		d := retry.RetryDelay(i)
+		assert.True(d >= 0 && d <= 50*time.Millisecond)
+	}
+}
+
+func TestEqualJitterRetry(t *testing.T) {
+	assert := assert.New(t)
+	retry := NewEqualJitterRetry(10*time.Millisecond, 50*time.Millisecond, time.Second, maxRand{})
+	assert.Equal(10*time.Millisecond, retry.RetryDelay(1))
+	assert.Equal(50*time.Millisecond, retry.RetryDelay(10))
+	retry = NewEqualJitterRetry(10*time.Millisecond, 0, time.Second, nil)
+	for i := 1; i < 20; i++ {
+		d := retry.RetryDelay(i)
+		assert.True(d >= 5*time.Millisecond && d <= time.Second)
+	}
+}
+
+func TestDecorrelatedJitterRetry(t *testing.T) {
+	assert := assert.New(t)
+	retry := NewDecorrelatedJitterRetry(10*time.Millisecond, 100*time.Millisecond, time.Second, maxRand{})
+	assert.Equal(30*time.Millisecond, retry.RetryDelay(1))
+	assert.Equal(90*time.Millisecond, retry.RetryDelay(2))
+	assert.Equal(100*time.Millisecond, retry.RetryDelay(3))
+	assert.Equal(30*time.Millisecond, retry.RetryDelay(1))
+	rr := retry.(RequestRetryable)
+	assert.Equal(30*time.Millisecond, rr.RetryRequestDelay(1, 0, nil))
+	assert.Equal(60*time.Millisecond, rr.RetryRequestDelay(2, 20*time.Millisecond, nil))
+	assert.Equal(100*time.Millisecond, rr.RetryRequestDelay(3, 60*time.Millisecond, nil))
+	// the delay of one request doesn't depend on the others retried at the same time
+	var wg sync.WaitGroup
+	for i := 1; i <= 3; i++ {
+		wg.Add(1)
+		go func(prev time.Duration) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				assert.Equal(3*prev, rr.RetryRequestDelay(2, prev, nil))
+			}
+		}(time.Duration(i) * 10 * time.Millisecond)
+	}
+	wg.Wait()
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsTemporaryError(t *testing.T) {
+	assert := assert.New(t)
+	assert.False(IsTemporaryError(nil))
+	assert.False(IsTemporaryError(errors.New("error")))
+	assert.False(IsTemporaryError(context.Canceled))
+	assert.False(IsTemporaryError(&url.Error{Op: "Get", URL: "/", Err: context.Canceled}))
+	_, err := url.Parse("http://[::1")
+	assert.False(IsTemporaryError(err))
+	assert.False(IsTemporaryError(&url.Error{Op: "Get", URL: "/", Err: x509.UnknownAuthorityError{}}))
+	assert.False(IsTemporaryError(&url.Error{Op: "Get", URL: "/", Err: x509.HostnameError{}}))
+	assert.False(IsTemporaryError(&net.DNSError{Err: "no such host", IsNotFound: true}))
+	assert.True(IsTemporaryError(&net.DNSError{Err: "server misbehaving", IsTemporary: true}))
+	// the retries of another HTTPClient are already exhausted
+	assert.False(IsTemporaryError(ErrRequestTimeout))
+	assert.False(IsTemporaryError(&RetryExhaustedError{Err: errors.New("error")}))
+	assert.True(IsTemporaryError(&url.Error{Op: "Get", URL: "/", Err: io.EOF}))
+	assert.True(IsTemporaryError(&url.Error{Op: "Get", URL: "/", Err: context.DeadlineExceeded}))
+	assert.True(IsTemporaryError(&url.Error{Op: "Get", URL: "/", Err: timeoutError{}}))
+	assert.True(IsTemporaryError(&url.Error{Op: "Post", URL: "/", Err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}))
+	assert.True(IsTemporaryError(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}))
+}
@@ -2,33 +2,67 @@ package httpclient
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"io/ioutil"
 )
 
 // borrowed from https://golang.org/src/io/multi.go
 
+// errStreamLimit is returned by Add when the stream would be larger than its max size
+var errStreamLimit = errors.New("httpclient: stream limit reached")
+
 type multiReader struct {
 	streams []io.Reader
+	size    int64
+	max     int64
 }
 
 func newMuliReader() *multiReader {
 	return &multiReader{}
 }
 
-func (r *multiReader) Add(rc io.ReadCloser) error {
+// ctxReader returns the error of the context once it's done instead of reading
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+func (r *multiReader) Add(ctx context.Context, rc io.ReadCloser) error {
 	if r.streams == nil {
 		r.streams = make([]io.Reader, 0)
 	}
 	// NOTE: we read all in memory which is terrible _but_ with load testing
 	// under windows, we get weird "wsasend: An existing connection was forcibly closed by the remote host."
 	// messages by keeping multiple connections open (>300)
-	buf, err := ioutil.ReadAll(rc)
+	var reader io.Reader = &ctxReader{ctx, rc}
+	if r.max > 0 {
+		// read one more byte than we allow to know if the limit was exceeded
+		reader = io.LimitReader(reader, r.max-r.size+1)
+	}
+	buf, err := ioutil.ReadAll(reader)
 	if err != nil {
 		rc.Close()
 		return err
 	}
 	rc.Close()
+	return r.AddBytes(buf)
+}
+
+// AddBytes adds a body which is already in memory without copying it
+func (r *multiReader) AddBytes(buf []byte) error {
+	if r.max > 0 && r.size+int64(len(buf)) > r.max {
+		return errStreamLimit
+	}
+	r.size += int64(len(buf))
 	r.streams = append(r.streams, bytes.NewReader(buf))
 	return nil
 }
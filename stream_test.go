@@ -2,6 +2,7 @@ package httpclient
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io/ioutil"
 	"testing"
@@ -32,7 +33,7 @@ func TestMultiStream(t *testing.T) {
 	assert.Nil(stream.streams)
 	var r testReader
 	r.buf.WriteString("hi")
-	stream.Add(&r)
+	stream.Add(context.Background(), &r)
 	assert.NotNil(stream.streams)
 	buf, err := ioutil.ReadAll(stream)
 	assert.NoError(err)
@@ -52,10 +53,37 @@ func TestMultiStreamCloseError(t *testing.T) {
 	assert.Nil(stream.streams)
 	var r testReader
 	r.buf.WriteString("hi")
-	stream.Add(&r)
+	stream.Add(context.Background(), &r)
 	re := &testReader{}
 	re.err = errors.New("error")
-	stream.Add(re)
+	stream.Add(context.Background(), re)
 	assert.NotNil(stream.streams)
 	assert.Len(stream.streams, 2)
 }
+
+func TestMultiStreamCancelled(t *testing.T) {
+	assert := assert.New(t)
+	stream := newMuliReader()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := &testReader{}
+	r.buf.WriteString("hi")
+	assert.Equal(context.Canceled, stream.Add(ctx, r))
+	assert.True(r.closed)
+	assert.Len(stream.streams, 0)
+}
+
+func TestMultiStreamMax(t *testing.T) {
+	assert := assert.New(t)
+	stream := newMuliReader()
+	stream.max = 3
+	r := &testReader{}
+	r.buf.WriteString("hi")
+	assert.NoError(stream.Add(context.Background(), r))
+	r = &testReader{}
+	r.buf.WriteString("hi")
+	assert.Equal(errStreamLimit, stream.Add(context.Background(), r))
+	assert.True(r.closed)
+	assert.Len(stream.streams, 1)
+	assert.Equal(int64(2), stream.size)
+}